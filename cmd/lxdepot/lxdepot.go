@@ -19,6 +19,8 @@ import (
 	"github.com/neophenix/lxdepot/internal/handlers"
 	"github.com/neophenix/lxdepot/internal/handlers/ws"
 	"github.com/neophenix/lxdepot/internal/lxd"
+	"github.com/neophenix/lxdepot/internal/placement"
+	"github.com/neophenix/lxdepot/internal/scheduler"
 )
 
 // All our command line params and config
@@ -49,6 +51,13 @@ func main() {
 	lxd.Conf = Conf
 	handlers.Conf = Conf
 	ws.Conf = Conf
+	scheduler.Conf = Conf
+	placement.Conf = Conf
+
+	// the config doesn't know about our placement policies, so we make sure the default is one we have here
+	if placement.New(Conf.Placement) == nil {
+		log.Fatal("unknown placement policy: " + Conf.Placement + "\n")
+	}
 
 	handlers.WebRoot = webroot
 	handlers.CacheTemplates = cacheTemplates
@@ -63,15 +72,37 @@ func main() {
 	handlers.AddRoute("/containers/.*$", handlers.ContainerHostListHandler)
 	handlers.AddRoute("/container/new$", handlers.NewContainerHandler)
 	handlers.AddRoute("/container/.*$", handlers.ContainerHandler)
+	handlers.AddRoute("/terminal/.*$", handlers.TerminalHandler)
+	handlers.AddRoute("/console/.*$", handlers.ConsoleHandler)
+	handlers.AddRoute("/files/.*$", handlers.FilesHandler)
+	handlers.AddRoute("/config/.*$", handlers.ConfigHandler)
 	handlers.AddRoute("/images$", handlers.ImageListHandler)
+	handlers.AddRoute("/images/upload$", handlers.ImageUploadHandler)
+	handlers.AddRoute("/images/sync$", handlers.ImageSyncHandler)
+	handlers.AddRoute("/networks$", handlers.NetworkListHandler)
+	handlers.AddRoute("/storage$", handlers.StorageListHandler)
 	handlers.AddRoute("/hosts$", handlers.HostListHandler)
 	handlers.AddRoute("/ws$", ws.Handler)
+	handlers.AddRoute("/ws/terminal$", ws.TerminalHandler)
+	handlers.AddRoute("/ws/console$", ws.ConsoleHandler)
 
 	// The root handler does all the route checking and handoffs
 	http.HandleFunc("/", handlers.RootHandler)
 
 	// our websocket maintenance function to clear out old buffers
 	ws.ManageBuffers()
+	// and passing container changes from each host on to the browsers
+	ws.StartEvents()
+
+	// keep an eye on which hosts are up
+	lxd.StartHealthChecks()
+	// and what is on them, so pages don't have to ask every host every time
+	lxd.StartInventory()
+
+	// scheduled snapshots, if any policies are configured
+	scheduler.StartSnapshots()
+	// and keeping images in sync, if there is an image set
+	scheduler.StartImageSync()
 
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
@@ -5,6 +5,7 @@ package circularbuffer
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,10 +17,15 @@ const BUFLEN = 20
 // "recent" or not
 const RECENTACCESS = 86400
 
+// sequence numbers every message across all our buffers, so someone reading from more than one buffer can take the
+// messages in the order they were written
+var sequence uint64
+
 type CircularBuffer[T any] struct {
 	head       int8 // "write" pointer
 	tail       int8 // "read" pointer
 	buffer     [BUFLEN]T
+	sequences  [BUFLEN]uint64 // sequence number of each message in buffer
 	lastAccess time.Time
 	lock       sync.Mutex
 }
@@ -33,6 +39,7 @@ func (c *CircularBuffer[T]) Enqueue(msg T) {
 	c.lastAccess = time.Now()
 	// put our message in
 	c.buffer[c.head] = msg
+	c.sequences[c.head] = atomic.AddUint64(&sequence, 1)
 	// get our new head pointer
 	newHead := (c.head + 1) % BUFLEN
 	if newHead == c.tail {
@@ -62,6 +69,18 @@ func (c *CircularBuffer[T]) Dequeue() (T, bool) {
 	return msg, true
 }
 
+// Oldest returns the sequence number of the first unread message, false if there isn't one.  Comparing this between
+// buffers tells us which has the message that was written first
+func (c *CircularBuffer[T]) Oldest() (uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.head == c.tail {
+		return 0, false
+	}
+
+	return c.sequences[c.tail], true
+}
+
 // HasRecentAccess returns true / false if a buffer has been "recently" accessed.  Check the value of RECENTACCESS for
 // what we consider recent
 func (c *CircularBuffer[T]) HasRecentAccess() bool {
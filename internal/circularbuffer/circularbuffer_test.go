@@ -74,3 +74,37 @@ func TestRecentAccess(t *testing.T) {
 		t.Error("expected old buffer HasRecentAccess to be false, but it is true")
 	}
 }
+
+// messages in two buffers should come out in the order they were written when we go by Oldest
+func TestOldest(t *testing.T) {
+	a := &CircularBuffer[string]{}
+	b := &CircularBuffer[string]{}
+
+	if _, ok := a.Oldest(); ok {
+		t.Error("expected an empty buffer to have no oldest message")
+	}
+
+	a.Enqueue("1")
+	b.Enqueue("2")
+	a.Enqueue("3")
+
+	var got []string
+	for {
+		aseq, aok := a.Oldest()
+		bseq, bok := b.Oldest()
+		if !aok && !bok {
+			break
+		}
+		if aok && (!bok || aseq < bseq) {
+			v, _ := a.Dequeue()
+			got = append(got, v)
+		} else {
+			v, _ := b.Dequeue()
+			got = append(got, v)
+		}
+	}
+
+	if strings.Join(got, ",") != "1,2,3" {
+		t.Errorf("expected 1,2,3 got %v", got)
+	}
+}
@@ -3,11 +3,14 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/neophenix/lxdepot/internal/utils"
 	"gopkg.in/yaml.v2"
 )
 
@@ -19,6 +22,11 @@ type LXDhost struct {
 	Name string `yaml:"name"` // A human readable name / "alias" for the UI
 	Port string `yaml:"port"` // The port that LXD is listening on
 	Cert string `yaml:"cert"` // The server cert typically found in /var/lib/lxd/server.crt
+
+	CertSource string `yaml:"-"` // cert as it was in the config, so a file:/path cert can be read again when the host gets a new one
+
+	Projects []string `yaml:"projects"` // LXD projects we manage on this host, defaults to the global projects list
+	Tags     []string `yaml:"tags"`     // free form labels like ssd or gpu, automatic placement can require a host have some
 }
 
 // DNS settings, or are we using DHCP or a 3rd party provider
@@ -47,6 +55,40 @@ type NetworkingConfig struct {
 	Template   string `yaml:"template"`    // text/template parsable version of the file
 }
 
+// SnapshotPolicy is a recurring snapshot taken of a set of containers, along with how many we keep around.
+// A policy applies to any container listed by name, and any container with user.lxdepot_snapshot_policy
+// set to the policy name (comma separate multiple policies)
+type SnapshotPolicy struct {
+	Name       string        `yaml:"name"`       // name of the policy, also used as the prefix of the snapshots it takes
+	Containers []string      `yaml:"containers"` // list of container names this policy applies to
+	Schedule   string        `yaml:"schedule"`   // hourly, daily, weekly or anything time.ParseDuration understands, like 6h
+	Retain     int           `yaml:"retain"`     // number of snapshots taken by this policy to keep, older ones are removed
+	Stateful   bool          `yaml:"stateful"`   // take stateful snapshots, requires CRIU on the host
+	Interval   time.Duration `yaml:"-"`          // Schedule parsed by verifyConfig
+}
+
+// SyncedImage is an image alias we want on every host.  If Server is set the image comes from that public image server,
+// otherwise whichever host is listed first in lxdhosts with the alias is treated as the source
+type SyncedImage struct {
+	Alias    string `yaml:"alias"`    // alias the image should have on every host
+	Server   string `yaml:"server"`   // optional image server to pull from, like https://images.linuxcontainers.org
+	Protocol string `yaml:"protocol"` // simplestreams (the default) or lxd, for Server
+	Image    string `yaml:"image"`    // alias or fingerprint on Server, defaults to Alias
+}
+
+// ImageSync is our declared image set, and how often we make sure every host has it
+type ImageSync struct {
+	Schedule string         `yaml:"schedule"` // same as a snapshot policy schedule, defaults to hourly
+	Images   []*SyncedImage `yaml:"images"`   // images every host should have
+	Interval time.Duration  `yaml:"-"`        // Schedule parsed by verifyConfig
+}
+
+// Inventory is how fresh we keep our in memory copy of what is on every host
+type Inventory struct {
+	MaxAge string        `yaml:"max_age"` // how old the inventory can get before a page has to wait on a refresh, like 30s (the default)
+	Age    time.Duration `yaml:"-"`       // MaxAge parsed by verifyConfig
+}
+
 // Config is the main config structure mostly pulling together the above items, also holds our client PKI
 type Config struct {
 	Cert       string                                `yaml:"cert"`       // client cert, which can either be the cert contents or file:/path/here that we will read in later
@@ -56,6 +98,14 @@ type Config struct {
 	Networking map[string][]NetworkingConfig         `yaml:"networking"` // map of OS -> network template files
 	Bootstrap  map[string][]FileOrCommand            `yaml:"bootstrap"`  // map to the OS type, and then an array of things to do
 	Playbooks  map[string]map[string][]FileOrCommand `yaml:"playbooks"`  // map of OS -> playbook name -> list of things to do
+	Projects   []string                              `yaml:"projects"`   // LXD projects to manage on hosts that don't list their own, defaults to just default
+
+	SnapshotPolicies []*SnapshotPolicy `yaml:"snapshot_policies"` // scheduled snapshots and their retention
+	ImageSync        *ImageSync        `yaml:"image_sync"`        // images to keep in sync across all hosts
+	Inventory        *Inventory        `yaml:"inventory"`         // how fresh to keep our copy of every hosts containers, images and resources
+	Placement        string            `yaml:"placement"`         // default policy for picking a host automatically, see the placement package
+	MaxImageUpload   string            `yaml:"max_image_upload"`  // largest image upload we will take, like 10GB (the default)
+	ImageUploadLimit int64             `yaml:"-"`                 // MaxImageUpload in bytes, parsed by verifyConfig
 }
 
 // ParseConfig is the only function that external users need to know about.
@@ -116,8 +166,130 @@ func (c *Config) verifyConfig() {
 		if lxdh.Cert == "" {
 			log.Fatal("missing certificate for lxdhost: " + lxdh.Host + "\n")
 		}
+		lxdh.CertSource = lxdh.Cert
 		lxdh.Cert = getValueOrFileContents(lxdh.Cert)
+
+		if len(lxdh.Projects) == 0 {
+			lxdh.Projects = c.Projects
+		}
+		if len(lxdh.Projects) == 0 {
+			lxdh.Projects = []string{"default"}
+		}
+		for _, project := range lxdh.Projects {
+			if project == "" {
+				log.Fatal("empty project name for lxdhost: " + lxdh.Host + "\n")
+			}
+		}
+	}
+
+	for idx, policy := range c.SnapshotPolicies {
+		if policy.Name == "" {
+			log.Fatal("missing name for snapshot policy at index: " + strconv.Itoa(idx) + "\n")
+		}
+		if policy.Retain < 1 {
+			log.Fatal("retain must be at least 1 for snapshot policy: " + policy.Name + "\n")
+		}
+
+		interval, err := parseSchedule(policy.Schedule)
+		if err != nil {
+			log.Fatal("invalid schedule for snapshot policy " + policy.Name + " : " + err.Error() + "\n")
+		}
+		policy.Interval = interval
 	}
+
+	if c.ImageSync != nil {
+		if c.ImageSync.Schedule == "" {
+			c.ImageSync.Schedule = "hourly"
+		}
+		interval, err := parseSchedule(c.ImageSync.Schedule)
+		if err != nil {
+			log.Fatal("invalid schedule for image_sync : " + err.Error() + "\n")
+		}
+		c.ImageSync.Interval = interval
+
+		for idx, image := range c.ImageSync.Images {
+			if image.Alias == "" {
+				log.Fatal("missing alias for image_sync image at index: " + strconv.Itoa(idx) + "\n")
+			}
+			if image.Image == "" {
+				image.Image = image.Alias
+			}
+			if image.Protocol == "" {
+				image.Protocol = "simplestreams"
+			}
+			if image.Protocol != "simplestreams" && image.Protocol != "lxd" {
+				log.Fatal("protocol must be simplestreams or lxd for image_sync image: " + image.Alias + "\n")
+			}
+		}
+	}
+
+	if c.Inventory == nil {
+		c.Inventory = &Inventory{}
+	}
+	if c.Inventory.MaxAge == "" {
+		c.Inventory.MaxAge = "30s"
+	}
+	age, err := time.ParseDuration(c.Inventory.MaxAge)
+	if err != nil {
+		log.Fatal("invalid max_age for inventory : " + err.Error() + "\n")
+	}
+	// we refresh twice every max_age in the background, anything shorter than this would just keep every host busy
+	if age < time.Second {
+		log.Fatal("max_age for inventory must be at least 1s\n")
+	}
+	c.Inventory.Age = age
+
+	if c.MaxImageUpload == "" {
+		c.MaxImageUpload = "10GB"
+	}
+	limit, err := utils.ParseByteSize(c.MaxImageUpload)
+	if err != nil {
+		log.Fatal("invalid max_image_upload : " + err.Error() + "\n")
+	}
+	if limit == 0 {
+		log.Fatal("max_image_upload must be more than 0\n")
+	}
+	c.ImageUploadLimit = int64(limit)
+}
+
+// parseSchedule converts a snapshot policy or image sync schedule into how often it should run.  We accept a few friendly
+// names and fall back to time.ParseDuration for anything else
+func parseSchedule(schedule string) (time.Duration, error) {
+	switch strings.ToLower(schedule) {
+	case "hourly":
+		return time.Hour, nil
+	case "daily", "nightly":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	interval, err := time.ParseDuration(schedule)
+	if err != nil {
+		return 0, err
+	}
+	// anything shorter than our scheduler tick doesn't make a lot of sense
+	if interval < time.Minute {
+		return 0, errors.New("schedule must be at least 1m")
+	}
+
+	return interval, nil
+}
+
+// ReloadCert reads the hosts cert file again, for when the host has a new certificate and we need to reconnect.
+// Returns false if the cert was given in the config itself, we can't pick up a new one of those without a restart
+func (h *LXDhost) ReloadCert() (bool, error) {
+	if !strings.HasPrefix(h.CertSource, "file:") {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(strings.TrimPrefix(h.CertSource, "file:"))
+	if err != nil {
+		return true, err
+	}
+	h.Cert = string(data)
+
+	return true, nil
 }
 
 // getValueOrFileContents is used by verifyConfig to check if the value of a param is file:/path
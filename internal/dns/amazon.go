@@ -254,3 +254,24 @@ func (a *AmazonDNS) ListARecords() ([]RecordList, error) {
 
 	return list, nil
 }
+
+// RenameARecord looks up the address of oldName and creates a record for newName with it, only removing
+// the old record once the new one is in place
+func (a *AmazonDNS) RenameARecord(oldName string, newName string) error {
+	list, err := a.ListARecords()
+	if err != nil {
+		return err
+	}
+
+	ip, ok := findARecord(list, oldName)
+	if !ok {
+		return errors.New("no A record found for " + oldName)
+	}
+
+	err = a.createARecord(newName, ip)
+	if err != nil {
+		return err
+	}
+
+	return a.deleteARecord(oldName)
+}
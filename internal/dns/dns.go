@@ -23,6 +23,7 @@ type DNS interface {
 	GetARecord(name string, networkBlocks []string) (string, error) // returns a string representation of an IPv4 address
 	RemoveARecord(name string) error                                // removes the record from our 3rd party
 	ListARecords() ([]RecordList, error)                            // returns a list of all the A records
+	RenameARecord(oldName string, newName string) error             // moves the address from one name to another
 }
 
 // DNSOptions holds the various options from the main config we might want to use, this does
@@ -43,6 +44,22 @@ func New(conf *config.Config) DNS {
 	return nil
 }
 
+// findARecord looks through a list of records for the name and returns its first address.  Like the providers
+// if the name doesn't have a . we assume it needs the zone appended
+func findARecord(list []RecordList, name string) (string, bool) {
+	if !strings.Contains(name, ".") {
+		name = name + "." + DNSOptions.Zone + "."
+	}
+
+	for _, record := range list {
+		if record.Name == name && len(record.RecordSet) > 0 {
+			return record.RecordSet[0], true
+		}
+	}
+
+	return "", false
+}
+
 // findFreeARecord takes a populated list of octets 2->4 and a list of network blocks, looks through the list
 // to find an entry != 0 indicating that IP is free and returns it.  Blocks are used in order and we skip
 // 0 and 255 for octet4
@@ -55,3 +55,29 @@ func TestFindFreeARecord(t *testing.T) {
 		t.Errorf("T4: Expected 10.0.1.1 got %v", ip)
 	}
 }
+
+func TestFindARecord(t *testing.T) {
+	DNSOptions.Zone = "dev.example.com"
+	list := []RecordList{
+		{Name: "dev-alice-01.dev.example.com.", RecordSet: []string{"10.0.0.5"}},
+		{Name: "dev-bob-01.dev.example.com.", RecordSet: []string{"10.0.0.6"}},
+	}
+
+	// Test 1, short names get the zone appended
+	ip, ok := findARecord(list, "dev-bob-01")
+	if !ok || ip != "10.0.0.6" {
+		t.Errorf("T1: Expected 10.0.0.6 got %v", ip)
+	}
+
+	// Test 2, fqdns are used as is
+	ip, ok = findARecord(list, "dev-alice-01.dev.example.com.")
+	if !ok || ip != "10.0.0.5" {
+		t.Errorf("T2: Expected 10.0.0.5 got %v", ip)
+	}
+
+	// Test 3, missing records
+	ip, ok = findARecord(list, "dev-carol-01")
+	if ok {
+		t.Errorf("T3: Expected no record got %v", ip)
+	}
+}
@@ -247,3 +247,24 @@ func (g *GoogleDNS) ListARecords() ([]RecordList, error) {
 
 	return list, nil
 }
+
+// RenameARecord looks up the address of oldName and creates a record for newName with it, only removing
+// the old record once the new one is in place
+func (g *GoogleDNS) RenameARecord(oldName string, newName string) error {
+	list, err := g.ListARecords()
+	if err != nil {
+		return err
+	}
+
+	ip, ok := findARecord(list, oldName)
+	if !ok {
+		return errors.New("no A record found for " + oldName)
+	}
+
+	err = g.createARecord(newName, ip)
+	if err != nil {
+		return err
+	}
+
+	return g.deleteARecord(oldName)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/neophenix/lxdepot/internal/handlers/ws"
+	"github.com/neophenix/lxdepot/internal/lxd"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigHandler handles requests for /config/HOST:NAME, the editor for a containers config keys and devices.
+// A GET shows the current config, POSTing with action=preview shows the diff against what is on the container now,
+// and action=apply saves it as long as the container hasn't changed since the ETag we handed out
+func ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	reg := regexp.MustCompile("/config/(?P<Host>[^:]+):(?P<Name>.+)")
+	match := reg.FindStringSubmatch(r.URL.Path)
+
+	if len(match) != 3 {
+		FourOhFourHandler(w, r)
+		return
+	}
+	host := match[1]
+	project := getProject(r)
+	name := match[2]
+
+	containerInfo, err := lxd.GetContainers(host, project, name, false)
+	if err != nil {
+		log.Printf("Could not get container list %s\n", err.Error())
+	}
+	if len(containerInfo) == 0 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	current, etag, err := lxd.GetContainerConfig(host, project, name)
+	if err != nil {
+		renderConfigEditor(w, containerInfo[0], "", "", false, nil, err)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		text, err := yaml.Marshal(current)
+		if err != nil {
+			log.Printf("Could not YAMLify config %s\n", err.Error())
+		}
+		renderConfigEditor(w, containerInfo[0], string(text), etag, false, nil, nil)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		renderConfigEditor(w, containerInfo[0], "", etag, false, nil, err)
+		return
+	}
+	text := r.PostForm.Get("config")
+
+	var updated lxd.ContainerConfig
+	err = yaml.UnmarshalStrict([]byte(text), &updated)
+	if err != nil {
+		renderConfigEditor(w, containerInfo[0], text, r.PostForm.Get("etag"), false, nil, err)
+		return
+	}
+
+	err = lxd.ValidateContainerConfig(current, &updated)
+	if err != nil {
+		renderConfigEditor(w, containerInfo[0], text, r.PostForm.Get("etag"), false, nil, err)
+		return
+	}
+
+	if r.PostForm.Get("action") == "apply" {
+		log.Printf("updating config on container %v\n", name)
+		err = lxd.UpdateContainerConfig(host, project, name, &updated, r.PostForm.Get("etag"))
+		if err == nil {
+			http.Redirect(w, r, ws.ContainerURL(host, project, name), http.StatusSeeOther)
+			return
+		}
+		if !errors.Is(err, lxd.ErrConfigConflict) {
+			renderConfigEditor(w, containerInfo[0], text, r.PostForm.Get("etag"), false, nil, err)
+			return
+		}
+		// fall through and show the diff against the latest config so they can decide if they still want it
+	} else if r.PostForm.Get("etag") != etag {
+		err = lxd.ErrConfigConflict
+	}
+
+	// the diff is always against what is on the container right now, so from here on the current etag is the one
+	// that applies
+	changes := lxd.DiffContainerConfig(current, &updated)
+	renderConfigEditor(w, containerInfo[0], text, etag, true, changes, err)
+}
+
+// renderConfigEditor shows the config text for editing, the list of changes if we are previewing, and any error
+func renderConfigEditor(w http.ResponseWriter, container lxd.ContainerInfo, text string, etag string, preview bool, changes []lxd.ConfigChange, err error) {
+	w.Header().Set("Content-Type", "text/html")
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+		if errors.Is(err, lxd.ErrConfigConflict) {
+			errMsg += ", the changes below are against its current config"
+		}
+	}
+
+	tmpl := readTemplate("container_config.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":       "containers",
+		"Container":  container,
+		"Manageable": lxd.IsManageable(container),
+		"Config":     text,
+		"ETag":       etag,
+		"Changes":    changes,
+		"Preview":    preview,
+		"Error":      errMsg,
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// ConsoleHandler handles requests for /console/HOST:NAME, showing the console buffer and log files for a
+// container.  The page can also follow the console live through /ws/console
+func ConsoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	reg := regexp.MustCompile("/console/(?P<Host>[^:]+):(?P<Name>.+)")
+	match := reg.FindStringSubmatch(r.URL.Path)
+
+	if len(match) != 3 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	project := getProject(r)
+	containerInfo, err := lxd.GetContainers(match[1], project, match[2], false)
+	if err != nil {
+		log.Printf("Could not get container list %s\n", err.Error())
+	}
+	if len(containerInfo) == 0 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	// errors here go to the page as well, since not being able to read these is useful info itself
+	var consoleErr, logErr string
+	console, consoleTruncated, err := lxd.GetConsoleLog(match[1], project, match[2])
+	if err != nil {
+		consoleErr = err.Error()
+	}
+	logFiles, err := lxd.GetLogFiles(match[1], project, match[2])
+	if err != nil {
+		logErr = err.Error()
+	}
+
+	tmpl := readTemplate("console.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":             "containers",
+		"Container":        containerInfo[0],
+		"Console":          console,
+		"ConsoleTruncated": consoleTruncated,
+		"ConsoleErr":       consoleErr,
+		"LogFiles":         logFiles,
+		"LogErr":           logErr,
+		"LogReadLen":       int64(lxd.LOGREADLEN),
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
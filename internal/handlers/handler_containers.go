@@ -9,31 +9,34 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/neophenix/lxdepot/internal/lxd"
+	"github.com/neophenix/lxdepot/internal/placement"
+	"github.com/neophenix/lxdepot/internal/scheduler"
 )
 
-// ContainerListHandler handles requests for /containers
+// ContainerListHandler handles requests for /containers, optionally limited to a project with ?project=NAME
 func ContainerListHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	containerInfo, err := lxd.GetContainers("", "", true)
-	if err != nil {
-		log.Printf("Could not get container list %s\n", err.Error())
-	}
+	// hosts that didn't answer the last inventory refresh are left out, and we tell the user about them
+	list := lxd.InventoryContainers("", r.URL.Query().Get("project"), "")
 
 	tmpl := readTemplate("container_list.tmpl")
 
 	var out bytes.Buffer
 	tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
 		"Page":       "containers",
-		"Containers": containerInfo,
+		"Containers": list.Containers,
+		"Failures":   list.Failures,
+		"UpdatedAgo": time.Since(lxd.InventoryUpdatedAt()).Round(time.Second),
 	})
 
 	fmt.Fprintf(w, string(out.Bytes()))
 }
 
-// ContainerHostListHandler handles requests for /containers/HOST
+// ContainerHostListHandler handles requests for /containers/HOST, like the full list this can be limited to a project
 func ContainerHostListHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
@@ -57,17 +60,16 @@ func ContainerHostListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	containerInfo, err := lxd.GetContainers(match[1], "", true)
-	if err != nil {
-		log.Printf("Could not get container list %s\n", err.Error())
-	}
+	list := lxd.InventoryContainers(match[1], r.URL.Query().Get("project"), "")
 
 	tmpl := readTemplate("container_list.tmpl")
 
 	var out bytes.Buffer
 	tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
 		"Page":       "containers",
-		"Containers": containerInfo,
+		"Containers": list.Containers,
+		"Failures":   list.Failures,
+		"UpdatedAgo": time.Since(lxd.InventoryUpdatedAt()).Round(time.Second),
 	})
 
 	fmt.Fprintf(w, string(out.Bytes()))
@@ -85,7 +87,8 @@ func ContainerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	containerInfo, err := lxd.GetContainers(match[1], match[2], true)
+	project := getProject(r)
+	containerInfo, err := lxd.GetContainers(match[1], project, match[2], true)
 	if err != nil {
 		log.Printf("Could not get container list %s\n", err.Error())
 	}
@@ -108,6 +111,52 @@ func ContainerHandler(w http.ResponseWriter, r *http.Request) {
 		playbooks = append(playbooks, "bootstrap")
 	}
 
+	snapshots, err := lxd.GetSnapshots(match[1], project, match[2])
+	if err != nil {
+		log.Printf("Could not get snapshot list %s\n", err.Error())
+	}
+
+	devices, err := lxd.GetDevices(match[1], project, match[2])
+	if err != nil {
+		log.Printf("Could not get device list %s\n", err.Error())
+	}
+
+	// profiles on the host that aren't already applied, so they can be added
+	var profiles []string
+	hostProfiles, err := lxd.GetProfiles(match[1], project)
+	if err != nil {
+		log.Printf("Could not get profile list %s\n", err.Error())
+	}
+	for _, profile := range hostProfiles[match[1]] {
+		applied := false
+		for _, p := range containerInfo[0].Container.Profiles {
+			if p == profile {
+				applied = true
+			}
+		}
+		if !applied {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	// custom volumes in the same project that could be attached as a disk
+	volumes, err := lxd.GetStorageVolumes(match[1], project)
+	if err != nil {
+		log.Printf("Could not get volume list %s\n", err.Error())
+	}
+
+	// members of the cluster the container could be moved to, if the host is clustered
+	var members []lxd.ClusterMemberInfo
+	clusterMembers, err := lxd.GetClusterMembers(match[1])
+	if err != nil {
+		log.Printf("Could not get cluster members %s\n", err.Error())
+	}
+	for _, member := range clusterMembers[match[1]] {
+		if member.Name != containerInfo[0].Container.Location {
+			members = append(members, member)
+		}
+	}
+
 	tmpl := readTemplate("container.tmpl")
 
 	var out bytes.Buffer
@@ -116,6 +165,13 @@ func ContainerHandler(w http.ResponseWriter, r *http.Request) {
 		"Conf":      Conf,
 		"Container": containerInfo[0],
 		"Playbooks": playbooks,
+		"Snapshots": snapshots,
+		"Devices":   devices,
+		"Profiles":  profiles,
+		"Volumes":   volumes,
+		"Members":   members,
+		"Schedules": scheduler.GetSnapshotStatus(match[1], project, match[2]),
+		"Execs":     lxd.GetExecHistory(match[1], project, match[2]),
 	})
 	if err != nil {
 		log.Printf("%v\n", err.Error())
@@ -130,13 +186,22 @@ func NewContainerHandler(w http.ResponseWriter, r *http.Request) {
 
 	// images we want to map to host -> image alias so we can use JS
 	// in the template to make sure we only select an image on the selected host
-	images, err := lxd.GetImages("")
-	if err != nil {
-		log.Printf("Could not get image list %s\n", err.Error())
-	}
-	imageMap := make(map[string][]string)
+	images := lxd.InventoryImages("")
+	// host -> instance type -> aliases, so the form can only offer images that work for the chosen type
+	imageMap := make(map[string]map[string][]string)
 	for _, image := range images {
-		imageMap[image.Host.Host] = append(imageMap[image.Host.Host], image.Aliases[0].Name)
+		// we create from an alias, so images without one can't be picked
+		if len(image.Aliases) == 0 {
+			continue
+		}
+		imageType := image.Type
+		if imageType == "" {
+			imageType = "container"
+		}
+		if imageMap[image.Host.Host] == nil {
+			imageMap[image.Host.Host] = make(map[string][]string)
+		}
+		imageMap[image.Host.Host][imageType] = append(imageMap[image.Host.Host][imageType], image.Aliases[0].Name)
 	}
 	imageJSON, err := json.Marshal(imageMap)
 	if err != nil {
@@ -145,10 +210,7 @@ func NewContainerHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Like the images, we are going to get a mapping of host resources and then
 	// convert that to JSON to give the template something to work with
-	hostResourceMap, err := lxd.GetHostResources("")
-	if err != nil {
-		log.Printf("Could not get host resource list %s\n", err.Error())
-	}
+	hostResourceMap := lxd.InventoryHostResources("")
 
 	hostResourceJSON, err := json.Marshal(hostResourceMap)
 	if err != nil {
@@ -166,6 +228,69 @@ func NewContainerHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Could not JSONify storage pools %s\n", err.Error())
 	}
 
+	// and the same for profiles, which can be different in each project so this is host -> project -> profiles
+	hostProfiles := make(map[string]map[string][]string)
+	for _, lxdh := range Conf.LXDhosts {
+		hostProfiles[lxdh.Host] = make(map[string][]string)
+		for _, project := range lxdh.Projects {
+			profiles, err := lxd.GetProfiles(lxdh.Host, project)
+			if err != nil {
+				log.Printf("Could not get profiles %s\n", err.Error())
+			}
+			hostProfiles[lxdh.Host][project] = profiles[lxdh.Host]
+		}
+	}
+
+	hostProfileJSON, err := json.Marshal(hostProfiles)
+	if err != nil {
+		log.Printf("Could not JSONify profiles %s\n", err.Error())
+	}
+
+	// managed networks on each host, a nic can only use network= with those
+	hostNetworks := make(map[string][]string)
+	networks, err := lxd.GetNetworks("")
+	if err != nil {
+		log.Printf("Could not get networks %s\n", err.Error())
+	}
+	for _, network := range networks {
+		if network.Managed {
+			hostNetworks[network.Host.Host] = append(hostNetworks[network.Host.Host], network.Name)
+		}
+	}
+
+	hostNetworkJSON, err := json.Marshal(hostNetworks)
+	if err != nil {
+		log.Printf("Could not JSONify networks %s\n", err.Error())
+	}
+
+	// cluster members for each clustered host so a member can be targeted
+	hostMembers := make(map[string][]string)
+	clusterMembers, err := lxd.GetClusterMembers("")
+	if err != nil {
+		log.Printf("Could not get cluster members %s\n", err.Error())
+	}
+	for host, members := range clusterMembers {
+		for _, member := range members {
+			hostMembers[host] = append(hostMembers[host], member.Name)
+		}
+	}
+
+	hostMemberJSON, err := json.Marshal(hostMembers)
+	if err != nil {
+		log.Printf("Could not JSONify cluster members %s\n", err.Error())
+	}
+
+	// projects we manage on each host, for the project select
+	hostProjects := make(map[string][]string)
+	for _, lxdh := range Conf.LXDhosts {
+		hostProjects[lxdh.Host] = lxdh.Projects
+	}
+
+	hostProjectJSON, err := json.Marshal(hostProjects)
+	if err != nil {
+		log.Printf("Could not JSONify projects %s\n", err.Error())
+	}
+
 	tmpl := readTemplate("container_new.tmpl")
 
 	var out bytes.Buffer
@@ -175,6 +300,12 @@ func NewContainerHandler(w http.ResponseWriter, r *http.Request) {
 		"ImageJSON":        template.JS(imageJSON),
 		"HostResourceJSON": template.JS(hostResourceJSON),
 		"HostStorageJSON":  template.JS(hostStorageJSON),
+		"HostProfileJSON":  template.JS(hostProfileJSON),
+		"HostProjectJSON":  template.JS(hostProjectJSON),
+		"HostMemberJSON":   template.JS(hostMemberJSON),
+		"HostNetworkJSON":  template.JS(hostNetworkJSON),
+		"Policies":         placement.Policies(),
+		"DefaultPolicy":    placement.New("").Name(),
 	})
 
 	fmt.Fprintf(w, string(out.Bytes()))
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// FilesHandler handles requests for /files/HOST:NAME?path=/some/path.  A GET on a directory shows the file browser,
+// a GET on a file downloads it.  POSTs to a directory can upload a file, create a directory, or delete a path
+// depending on the action form field.  Uploads and downloads are streamed so large files never sit in memory.
+func FilesHandler(w http.ResponseWriter, r *http.Request) {
+	reg := regexp.MustCompile("/files/(?P<Host>[^:]+):(?P<Name>.+)")
+	match := reg.FindStringSubmatch(r.URL.Path)
+
+	if len(match) != 3 {
+		FourOhFourHandler(w, r)
+		return
+	}
+	host := match[1]
+	project := getProject(r)
+	name := match[2]
+
+	containerInfo, err := lxd.GetContainers(host, project, name, false)
+	if err != nil {
+		log.Printf("Could not get container list %s\n", err.Error())
+	}
+	if len(containerInfo) == 0 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	dir := cleanContainerPath(r.URL.Query().Get("path"))
+
+	if r.Method == http.MethodPost {
+		if !lxd.IsManageable(containerInfo[0]) {
+			renderFileBrowser(w, containerInfo[0], dir, getDirectory(host, project, name, dir), errors.New("lock flag set, remote management denied"))
+			return
+		}
+
+		err = handleFilesPost(r, host, project, name, dir)
+		if err != nil {
+			renderFileBrowser(w, containerInfo[0], dir, getDirectory(host, project, name, dir), err)
+			return
+		}
+
+		// back to the listing so a refresh doesn't post again
+		http.Redirect(w, r, filesURL(host, project, name, dir), http.StatusSeeOther)
+		return
+	}
+
+	content, info, err := lxd.GetFile(host, project, name, dir)
+	if err != nil {
+		renderFileBrowser(w, containerInfo[0], dir, nil, err)
+		return
+	}
+
+	if info.Type != "directory" {
+		defer content.Close()
+
+		log.Printf("downloading %v from container %v\n", dir, name)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(dir)}))
+		_, err = io.Copy(w, content)
+		if err != nil {
+			log.Printf("Could not send %v from %v : %s\n", dir, name, err.Error())
+		}
+		return
+	}
+
+	renderFileBrowser(w, containerInfo[0], dir, info, nil)
+}
+
+// handleFilesPost reads the multipart form one part at a time so file contents can be streamed.  The action field
+// has to come before anything else, which is how the forms on the page are laid out
+func handleFilesPost(r *http.Request, host string, project string, name string, dir string) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	action := ""
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch part.FormName() {
+		case "action":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				return err
+			}
+			action = string(value)
+		case "file":
+			if action != "upload" || part.FileName() == "" {
+				continue
+			}
+			return uploadFile(host, project, name, path.Join(dir, path.Base(part.FileName())), part)
+		case "dirname":
+			if action != "mkdir" {
+				continue
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return err
+			}
+			log.Printf("creating directory on container %v: %v\n", name, path.Join(dir, string(value)))
+			return lxd.MakeDirectory(host, project, name, path.Join(dir, path.Base(string(value))), 0755)
+		case "target":
+			if action != "delete" {
+				continue
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return err
+			}
+			target := cleanContainerPath(string(value))
+			if target == "/" {
+				return errors.New("refusing to delete /")
+			}
+			log.Printf("deleting path on container %v: %v\n", name, target)
+			return lxd.DeletePath(host, project, name, target)
+		}
+	}
+
+	return errors.New("request not understood")
+}
+
+// uploadFile spools the upload to a temp file, since the lxd client needs to be able to seek, and pushes that
+// to the container
+func uploadFile(host string, project string, name string, dst string, src io.Reader) error {
+	tmp, err := os.CreateTemp("", "lxdepot-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, src)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("uploading file to container %v: %v\n", name, dst)
+	return lxd.PushFile(host, project, name, dst, 0644, tmp)
+}
+
+// getDirectory lists a directory to show along with an error from something else.  If listing it fails as well we
+// log that and the page shows an empty listing with the original error
+func getDirectory(host string, project string, name string, dir string) *lxd.FileInfo {
+	content, info, err := lxd.GetFile(host, project, name, dir)
+	if err != nil {
+		log.Printf("Could not list %v on %v : %s\n", dir, name, err.Error())
+		return nil
+	}
+	if content != nil {
+		content.Close()
+	}
+	if info.Type != "directory" {
+		return nil
+	}
+
+	return info
+}
+
+// renderFileBrowser shows the directory listing, along with any error we hit.  If the directory itself is what
+// errored info is nil and we will just show an empty listing
+func renderFileBrowser(w http.ResponseWriter, container lxd.ContainerInfo, dir string, info *lxd.FileInfo, err error) {
+	w.Header().Set("Content-Type", "text/html")
+
+	// each entry gets the link to it so the template doesn't need to build paths
+	var entries []map[string]string
+	if info != nil {
+		for _, entry := range info.Entries {
+			entries = append(entries, map[string]string{
+				"Name": entry,
+				"Path": path.Join(dir, entry),
+				"URL":  filesURL(container.Host.Host, container.Project, container.Container.Name, path.Join(dir, entry)),
+			})
+		}
+	}
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	tmpl := readTemplate("files.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":       "containers",
+		"Container":  container,
+		"Manageable": lxd.IsManageable(container),
+		"Path":       dir,
+		"URL":        filesURL(container.Host.Host, container.Project, container.Container.Name, dir),
+		"ParentURL":  filesURL(container.Host.Host, container.Project, container.Container.Name, path.Dir(dir)),
+		"Info":       info,
+		"Entries":    entries,
+		"Error":      errMsg,
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
+
+// cleanContainerPath makes sure we always have an absolute, clean path, defaulting to /
+func cleanContainerPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// filesURL builds the url for a path in the file browser
+func filesURL(host string, project string, name string, p string) string {
+	return "/files/" + host + ":" + name + "?project=" + url.QueryEscape(project) + "&path=" + url.QueryEscape(p)
+}
@@ -13,22 +13,16 @@ import (
 func HostListHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	hostResourceMap, err := lxd.GetHostResources("")
-	if err != nil {
-		log.Printf("Could not get host resource list %s\n", err.Error())
-	}
+	hostResourceMap := lxd.InventoryHostResources("")
 
 	// host -> container info mapping
 	hostContainerInfo := make(map[string]map[string]int)
-	// Grab container info without state to see installed vs runnings
-	containerInfo, err := lxd.GetContainers("", "", false)
-	if err != nil {
-		log.Printf("Could not get container list %s\n", err.Error())
-	}
+	// Grab container info to see installed vs runnings
+	list := lxd.InventoryContainers("", "", "")
 
 	// Check the status of each container and increment the counter, if we haven't
 	// seen this host before make the map we need
-	for _, container := range containerInfo {
+	for _, container := range list.Containers {
 		if hostContainerInfo[container.Host.Host] == nil {
 			hostContainerInfo[container.Host.Host] = make(map[string]int)
 		}
@@ -41,6 +35,16 @@ func HostListHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	clusterMembers, err := lxd.GetClusterMembers("")
+	if err != nil {
+		log.Printf("Could not get cluster members %s\n", err.Error())
+	}
+
+	storagePools, err := lxd.GetStoragePoolUsage("")
+	if err != nil {
+		log.Printf("Could not get storage pool usage %s\n", err.Error())
+	}
+
 	tmpl := readTemplate("host_list.tmpl")
 
 	var out bytes.Buffer
@@ -49,6 +53,9 @@ func HostListHandler(w http.ResponseWriter, r *http.Request) {
 		"Conf":              Conf,
 		"HostResourceMap":   hostResourceMap,
 		"HostContainerInfo": hostContainerInfo,
+		"ClusterMembers":    clusterMembers,
+		"StoragePools":      storagePools,
+		"HostHealth":        lxd.GetHostHealth(),
 	})
 
 	fmt.Fprintf(w, string(out.Bytes()))
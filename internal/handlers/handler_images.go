@@ -2,29 +2,154 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 
+	"github.com/neophenix/lxdepot/internal/handlers/ws"
 	"github.com/neophenix/lxdepot/internal/lxd"
+	"github.com/neophenix/lxdepot/internal/scheduler"
 )
 
 // ImageListHandler handles requests for /images
 func ImageListHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	images, err := lxd.GetImages("")
-	if err != nil {
-		log.Printf("Could not get image list %s\n", err.Error())
-	}
+	images := lxd.InventoryImages("")
 
 	tmpl := readTemplate("image_list.tmpl")
 
 	var out bytes.Buffer
-	tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+	err := tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
 		"Page":   "images",
+		"Conf":   Conf,
 		"Images": images,
 	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
 
 	fmt.Fprintf(w, string(out.Bytes()))
 }
+
+// ImageSyncHandler handles requests for /images/sync, the report of which hosts have our image set
+func ImageSyncHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	tmpl := readTemplate("image_sync.tmpl")
+
+	var out bytes.Buffer
+	err := tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":    "images",
+		"Conf":    Conf,
+		"Reports": scheduler.GetImageSyncReport(),
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
+
+// ImageUploadHandler handles POSTs to /images/upload with an image tarball, or the metadata and rootfs tarballs of
+// a split image.  The files are saved and then the import to LXD happens in the background, reporting progress to
+// the uploading browser over its websocket.  The id, host and alias fields need to come before the files, and the
+// whole upload can't be more than max_image_upload
+func ImageUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.ContentLength > Conf.ImageUploadLimit {
+		http.Error(w, "upload is larger than max_image_upload "+Conf.MaxImageUpload, http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, Conf.ImageUploadLimit)
+
+	fields, files, err := readImageUpload(r)
+	if err != nil {
+		for _, f := range files {
+			os.Remove(f)
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("received image upload %v for %v\n", fields["meta"], fields["host"])
+	go ws.ImportImageFileHandler(ws.GetMessageBuffer(fields["id"]), fields["host"], fields["alias"], fields["meta"], files["meta"], fields["rootfs"], files["rootfs"])
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "upload received, importing")
+}
+
+// readImageUpload streams the multipart form, returning the text fields plus the uploaded filenames, and the path of
+// the temp file each upload was saved to.  The host is checked before we save any files, so a bad one doesn't cost us
+// spooling the whole image first
+func readImageUpload(r *http.Request) (map[string]string, map[string]string, error) {
+	fields := make(map[string]string)
+	files := make(map[string]string)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return fields, files, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fields, files, err
+		}
+
+		switch part.FormName() {
+		case "id", "host", "alias":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return fields, files, err
+			}
+			fields[part.FormName()] = string(value)
+		case "meta", "rootfs":
+			if part.FileName() == "" {
+				continue
+			}
+			if !knownHost(fields["host"]) {
+				return fields, files, errors.New("unknown host")
+			}
+			tmp, err := os.CreateTemp("", "lxdepot-image-")
+			if err != nil {
+				return fields, files, err
+			}
+			files[part.FormName()] = tmp.Name()
+			fields[part.FormName()] = part.FileName()
+
+			_, err = io.Copy(tmp, part)
+			tmp.Close()
+			if err != nil {
+				return fields, files, err
+			}
+		}
+	}
+
+	if fields["meta"] == "" {
+		return fields, files, errors.New("no image file uploaded")
+	}
+
+	return fields, files, nil
+}
+
+// knownHost is whether the host is one of the lxdhosts in our config
+func knownHost(host string) bool {
+	for _, lxdh := range Conf.LXDhosts {
+		if lxdh.Host == host {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// NetworkListHandler handles requests for /networks, listing the networks on each host and the DHCP leases
+// of the managed bridges
+func NetworkListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	networks, err := lxd.GetNetworks("")
+	if err != nil {
+		log.Printf("Could not get network list %s\n", err.Error())
+	}
+
+	tmpl := readTemplate("network_list.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":     "networks",
+		"Conf":     Conf,
+		"Networks": networks,
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
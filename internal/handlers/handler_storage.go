@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// StorageListHandler handles requests for /storage, listing the custom volumes on each host along with a form
+// to create new ones
+func StorageListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	volumes, err := lxd.GetStorageVolumes("", "")
+	if err != nil {
+		log.Printf("Could not get volume list %s\n", err.Error())
+	}
+
+	// pools and projects for the create form, which change with the host we pick
+	hostStoragePools, err := lxd.GetStoragePools("")
+	if err != nil {
+		log.Printf("Could not get storage pools %s\n", err.Error())
+	}
+
+	hostStorageJSON, err := json.Marshal(hostStoragePools)
+	if err != nil {
+		log.Printf("Could not JSONify storage pools %s\n", err.Error())
+	}
+
+	hostProjects := make(map[string][]string)
+	for _, lxdh := range Conf.LXDhosts {
+		hostProjects[lxdh.Host] = lxdh.Projects
+	}
+
+	hostProjectJSON, err := json.Marshal(hostProjects)
+	if err != nil {
+		log.Printf("Could not JSONify projects %s\n", err.Error())
+	}
+
+	tmpl := readTemplate("storage_list.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":            "storage",
+		"Conf":            Conf,
+		"Volumes":         volumes,
+		"HostStorageJSON": template.JS(hostStorageJSON),
+		"HostProjectJSON": template.JS(hostProjectJSON),
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
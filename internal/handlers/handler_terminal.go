@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// TerminalHandler handles requests for /terminal/HOST:NAME, the page itself connects back to /ws/terminal
+// for the actual shell
+func TerminalHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	reg := regexp.MustCompile("/terminal/(?P<Host>[^:]+):(?P<Name>.+)")
+	match := reg.FindStringSubmatch(r.URL.Path)
+
+	if len(match) != 3 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	project := getProject(r)
+	containerInfo, err := lxd.GetContainers(match[1], project, match[2], false)
+	if err != nil {
+		log.Printf("Could not get container list %s\n", err.Error())
+	}
+	if len(containerInfo) == 0 {
+		FourOhFourHandler(w, r)
+		return
+	}
+
+	tmpl := readTemplate("terminal.tmpl")
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, "base", map[string]interface{}{
+		"Page":       "containers",
+		"Container":  containerInfo[0],
+		"Manageable": lxd.IsManageable(containerInfo[0]),
+	})
+	if err != nil {
+		log.Printf("%v\n", err.Error())
+	}
+
+	fmt.Fprintf(w, string(out.Bytes()))
+}
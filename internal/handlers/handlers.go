@@ -2,8 +2,20 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/neophenix/lxdepot/internal/config"
 )
 
 // Conf is our main config
 var Conf *config.Config
+
+// getProject returns the LXD project a request is for, links from before we knew about projects don't have one
+// so those are the default project
+func getProject(r *http.Request) string {
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		return "default"
+	}
+	return project
+}
@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"sync"
+
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// subscribers are the event channels of every open websocket, events go to all of them not just the browser
+// that asked for something
+var subscribers = make(map[chan OutgoingMessage]bool)
+
+// mutex for our subscribers
+var subscriberMutex = &sync.Mutex{}
+
+// StartEvents starts watching the event streams of all our hosts, passing container lifecycle changes along to
+// every connected browser so pages can update without a reload
+func StartEvents() {
+	lxd.WatchEvents(broadcastEvent)
+}
+
+// subscribeEvents returns a channel that will get all the events while the websocket is open
+func subscribeEvents() chan OutgoingMessage {
+	// a little room so a burst of events, like stopping everything on a host, doesn't get dropped
+	events := make(chan OutgoingMessage, 50)
+
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+	subscribers[events] = true
+
+	return events
+}
+
+// unsubscribeEvents stops sending events to a channel once its websocket is gone
+func unsubscribeEvents(events chan OutgoingMessage) {
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+	delete(subscribers, events)
+}
+
+// broadcastEvent sends an event to every subscriber.  We never block here, if a browser isn't keeping up it will
+// miss some events, which is no worse than it was before it got any
+func broadcastEvent(event lxd.ContainerEvent) {
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+
+	for events := range subscribers {
+		select {
+		case events <- OutgoingMessage{Event: &event}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// AddDeviceHandler adds a nic, disk or proxy device to a container.  The device options come in as a JSON object
+// like the options on create, and include the device type
+func AddDeviceHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Adding device " + msg.Data["device"], Success: true})
+	}
+
+	var options map[string]string
+	err := json.Unmarshal([]byte(msg.Data["options"]), &options)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	err = lxd.AddDevice(msg.Data["host"], msg.Data["project"], msg.Data["name"], msg.Data["device"], options)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
+	}
+}
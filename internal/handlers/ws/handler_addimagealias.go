@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// AddImageAliasHandler adds an alias to an image
+func AddImageAliasHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Adding alias " + msg.Data["alias"], Success: true})
+	}
+
+	err := lxd.AddImageAlias(msg.Data["host"], msg.Data["fingerprint"], msg.Data["alias"])
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: "/images"})
+	}
+}
@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// AddProfileHandler applies a profile to an existing container
+func AddProfileHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Adding profile " + msg.Data["profile"], Success: true})
+	}
+
+	err := lxd.AddProfile(msg.Data["host"], msg.Data["project"], msg.Data["name"], msg.Data["profile"])
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
+	}
+}
@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// CloneContainerHandler copies a container (or one of its snapshots) to a new container on the same or another host.
+// Once the copy is done it goes through the same DNS, networking and optional bootstrap steps as a newly created container
+func CloneContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	dstHost := msg.Data["dst_host"]
+	if dstHost == "" {
+		dstHost = msg.Data["host"]
+	}
+
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		from := msg.Data["name"]
+		if msg.Data["snapshot"] != "" {
+			from += "/" + msg.Data["snapshot"]
+		}
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Cloning " + from + " to " + msg.Data["new_name"], Success: true})
+	}
+
+	if msg.Data["new_name"] == "" {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: a name for the new container is required", Success: false})
+		}
+		return
+	}
+
+	err := lxd.CloneContainer(msg.Data["host"], dstHost, msg.Data["project"], msg.Data["name"], msg.Data["new_name"], msg.Data["snapshot"])
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+	}
+
+	setupNewContainer(buffer, dstHost, msg.Data["project"], msg.Data["new_name"], msg.Data["bootstrap"] == "true")
+}
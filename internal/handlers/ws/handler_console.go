@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// ConsoleHandler streams a containers console to the console page until the browser goes away.  This is read only,
+// anything the browser sends other than a close is ignored.  The container is given by the host, project and name query params
+func ConsoleHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	project := r.URL.Query().Get("project")
+	name := r.URL.Query().Get("name")
+
+	conn, err := terminalUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print("console upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	output := &terminalWriter{conn: conn}
+
+	// we don't expect anything from the browser, but need to read to notice it going away
+	go func() {
+		defer close(stop)
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	err = lxd.FollowConsole(host, project, name, output, stop)
+	if err != nil {
+		output.Write([]byte("\r\n" + err.Error() + "\r\n"))
+	}
+
+	output.lock.Lock()
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	output.lock.Unlock()
+}
@@ -12,7 +12,7 @@ import (
 // re-bootstrapping it if asked.  Playbooks and bootstrap should be idempotent so no harm should come
 // from running these multiple times.
 func ContainerPlaybookHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
-	containerInfo, err := lxd.GetContainers(msg.Data["host"], msg.Data["name"], false)
+	containerInfo, err := lxd.GetContainers(msg.Data["host"], msg.Data["project"], msg.Data["name"], false)
 	if err != nil {
 		id := time.Now().UnixNano()
 		if buffer != nil {
@@ -42,7 +42,7 @@ func ContainerPlaybookHandler(buffer *circularbuffer.CircularBuffer[OutgoingMess
 	// bootstrap is a special playbook in that it has its own section of the config.  If we are asked to
 	// do this again, just call the bootstrap "handler" in handler_createcontainer
 	if msg.Data["playbook"] == "bootstrap" {
-		BootstrapContainer(buffer, msg.Data["host"], msg.Data["name"])
+		BootstrapContainer(buffer, msg.Data["host"], msg.Data["project"], msg.Data["name"])
 	} else if playbooks, ok := Conf.Playbooks[os]; ok {
 		if playbook, ok := playbooks[msg.Data["playbook"]]; ok {
 			// Once we are sure the OS for this image exists in or config and we have the requested playbook
@@ -51,12 +51,12 @@ func ContainerPlaybookHandler(buffer *circularbuffer.CircularBuffer[OutgoingMess
 				for _, step := range playbook {
 					// depending on the type, call the appropriate helper
 					if step.Type == "file" {
-						err = containerCreateFile(buffer, msg.Data["host"], msg.Data["name"], step)
+						err = containerCreateFile(buffer, msg.Data["host"], msg.Data["project"], msg.Data["name"], step)
 						if err != nil {
 							return
 						}
 					} else if step.Type == "command" {
-						err = containerExecCommand(buffer, msg.Data["host"], msg.Data["name"], step)
+						err = containerExecCommand(buffer, msg.Data["host"], msg.Data["project"], msg.Data["name"], step)
 						if err != nil {
 							return
 						}
@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// CopyImageHandler copies an image from one of our hosts to another, reporting progress as it goes
+func CopyImageHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Copying image to " + msg.Data["dst_host"], Success: true})
+	}
+
+	err := lxd.CopyImage(msg.Data["host"], msg.Data["dst_host"], msg.Data["fingerprint"], progressReporter(buffer, id))
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: "/images"})
+	}
+}
@@ -3,13 +3,17 @@ package ws
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"net/url"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/lxc/lxd/shared/api"
 	"github.com/neophenix/lxdepot/internal/circularbuffer"
 	"github.com/neophenix/lxdepot/internal/dns"
 	"github.com/neophenix/lxdepot/internal/lxd"
+	"github.com/neophenix/lxdepot/internal/placement"
 )
 
 // CreateContainerHandler creates the container on our host, then if we are using a 3rd
@@ -17,6 +21,17 @@ import (
 // It then uploads the appropriate network config file to the container before starting it by calling setupContainerNetwork
 // Finally if any bootstrapping configuration is set, it to perform that by calling BootstrapContainer.
 func CreateContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	// Pick a host, if the user left it up to us
+	// -------------------------
+	if msg.Data["host"] == "auto" {
+		host, err := placeContainer(buffer, msg)
+		if err != nil {
+			return
+		}
+		msg.Data["host"] = host
+	}
+	// -------------------------
+
 	// Create the container
 	// -------------------------
 	id := time.Now().UnixNano()
@@ -35,7 +50,19 @@ func CreateContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessag
 		return
 	}
 
-	err = lxd.CreateContainer(msg.Data["host"], msg.Data["name"], msg.Data["image"], msg.Data["storagepool"], options)
+	// profiles are optional, leaving them off gets the hosts default profile
+	var profiles []string
+	if msg.Data["profiles"] != "" {
+		err = json.Unmarshal([]byte(msg.Data["profiles"]), &profiles)
+		if err != nil {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+			}
+			return
+		}
+	}
+
+	err = lxd.CreateContainer(msg.Data["host"], msg.Data["project"], msg.Data["target"], msg.Data["name"], msg.Data["type"], msg.Data["image"], msg.Data["storagepool"], msg.Data["network"], profiles, options)
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -47,9 +74,81 @@ func CreateContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessag
 	}
 	// -------------------------
 
+	setupNewContainer(buffer, msg.Data["host"], msg.Data["project"], msg.Data["name"], true)
+}
+
+// placeContainer picks a host for a container using the placement policy the user chose, and lists what we thought
+// of every host so they can see why we went where we did
+func placeContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) (string, error) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Choosing a host", Success: true})
+	}
+
+	// we only need the limits here, a bad options value is reported when we go to create the container
+	var options map[string]string
+	json.Unmarshal([]byte(msg.Data["options"]), &options)
+
+	var tags []string
+	for _, tag := range strings.Split(msg.Data["tags"], ",") {
+		if strings.TrimSpace(tag) != "" {
+			tags = append(tags, strings.TrimSpace(tag))
+		}
+	}
+
+	decision, err := placement.Place(msg.Data["policy"], placement.Request{
+		Project:     msg.Data["project"],
+		Type:        msg.Data["type"],
+		Image:       msg.Data["image"],
+		StoragePool: msg.Data["storagepool"],
+		Tags:        tags,
+		Memory:      options["limits.memory"],
+		CPU:         options["limits.cpu"],
+	})
+	if buffer != nil {
+		if err != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		} else {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: decision.Host.Name + " by " + decision.Policy, Success: true})
+		}
+
+		// a line per host, all in one message so no matter how many hosts we have we don't push the rest of the
+		// create out of the buffer
+		var lines []string
+		for _, reason := range decision.Reasons {
+			if reason.Chosen {
+				lines = append(lines, reason.Host.Name+": chosen, "+reason.Message)
+			} else {
+				lines = append(lines, reason.Host.Name+": "+reason.Message)
+			}
+		}
+		if len(lines) > 0 {
+			buffer.Enqueue(OutgoingMessage{Message: strings.Join(lines, "\n"), Success: true, Stream: "stdout"})
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return decision.Host.Host, nil
+}
+
+// setupNewContainer takes a freshly created (or cloned) stopped container and gets it ready for use.  If we are using
+// a 3rd party DNS it gets an A record and uploads the network config by calling setupContainerNetwork, then starts
+// the container, waits for networking, and optionally bootstraps it
+func setupNewContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string, bootstrap bool) {
+	// Virtual machines can't have files pushed to them until they are running and their agent is up, so for them
+	// the network config is uploaded after starting and then the VM is restarted to pick it up
+	vm := false
+	containerInfo, err := lxd.GetContainers(host, project, name, false)
+	if err == nil && len(containerInfo) > 0 {
+		vm = containerInfo[0].Container.Type == string(api.InstanceTypeVM)
+	}
+
 	// DNS Previously we would fail here and continue, but that has been shown to lead to multiple containers being assigned
 	// the same IP, which turns out is a bad idea.  So now we will fail, and let the user cleanup.
 	// -------------------------
+	ip := ""
 	if strings.ToLower(Conf.DNS.Provider) != "dhcp" {
 		id := time.Now().UnixNano()
 		if buffer != nil {
@@ -63,7 +162,7 @@ func CreateContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessag
 			}
 			return
 		} else {
-			ip, err := d.GetARecord(msg.Data["name"], Conf.DNS.NetworkBlocks)
+			ip, err = d.GetARecord(name, Conf.DNS.NetworkBlocks)
 			if err != nil {
 				if buffer != nil {
 					buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -75,69 +174,128 @@ func CreateContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessag
 				}
 
 				// upload our network config
-				setupContainerNetwork(buffer, msg.Data["host"], msg.Data["name"], ip)
+				if !vm {
+					setupContainerNetwork(buffer, host, project, name, ip)
+				}
 			}
 		}
 	}
 	// -------------------------
 
 	// Start the container
-	err = StartContainerHandler(buffer, msg)
+	err = StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": host, "project": project, "name": name}})
 	if err != nil {
 		// The other handler would have taken care of the message
 		return
 	}
 
-	id = time.Now().UnixNano()
+	if vm && ip != "" {
+		err = setupVMNetwork(buffer, host, project, name, ip)
+		if err != nil {
+			return
+		}
+	}
+
+	id := time.Now().UnixNano()
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Waiting for networking", Success: true})
 	}
 
-	// We will try 10 times to see if the networking comes up by asking LXD for the container state
-	// and checking to see if we found an ipv4 address
-	networkUp := false
-	i := 0
-	for !networkUp && i < 10 {
+	addresses, err := waitForNetwork(host, project, name)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: err.Error(), Success: false})
+		}
+		return
+	}
+	if len(addresses) == 0 {
+		// we will bail if we didn't get an address since if we plan on bootstrapping we won't get far
+		// send the user to the console so they can see why
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "no ip detected, check the console", Success: false})
+			buffer.Enqueue(OutgoingMessage{Redirect: "/console/" + host + ":" + name + "?project=" + url.QueryEscape(project)})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "network is up", Success: true})
+	}
+
+	if bootstrap {
+		BootstrapContainer(buffer, host, project, name)
+	}
+}
+
+// setupVMNetwork uploads the network config to a running virtual machine once its agent is up, and then restarts
+// it so the config is used
+func setupVMNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string, ip string) error {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Waiting for lxd-agent", Success: true})
+	}
+
+	err := lxd.WaitForAgent(host, project, name, 2*time.Minute)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return err
+	}
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+	}
+
+	err = setupContainerNetwork(buffer, host, project, name, ip)
+	if err != nil {
+		return err
+	}
+
+	err = stopContainer(buffer, host, project, name)
+	if err != nil {
+		return err
+	}
+
+	return StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": host, "project": project, "name": name}})
+}
+
+// waitForNetwork will try 10 times to see if the networking comes up by asking LXD for the container state
+// and returns any ipv4 addresses it found, or an empty list if none showed up in time
+func waitForNetwork(host string, project string, name string) ([]string, error) {
+	var addresses []string
+
+	for i := 0; len(addresses) == 0 && i < 10; i++ {
 		// this isn't exactly as efficient as it could be but don't feel like making a new call just for this at the moment
-		containerInfo, err := lxd.GetContainers(msg.Data["host"], msg.Data["name"], true)
+		containerInfo, err := lxd.GetContainers(host, project, name, true)
 		if err != nil {
-			if buffer != nil {
-				buffer.Enqueue(OutgoingMessage{ID: id, Message: err.Error(), Success: false})
-			}
-			return
+			return addresses, err
+		}
+		if len(containerInfo) == 0 {
+			return addresses, errors.New("container does not exist")
 		}
-		// look through the container state for an address in the inet family, right not we aren't worried about comparing
-		// this address to what we got from DNS if we are using that, maybe in the future if it becomes an issue
+
+		// look through the container state for an address in the inet family
 		for iface, info := range containerInfo[0].State.Network {
 			if iface != "lo" {
 				for _, addr := range info.Addresses {
 					if addr.Family == "inet" && addr.Address != "" {
-						networkUp = true
+						addresses = append(addresses, addr.Address)
 					}
 				}
 			}
 		}
-		i++
-		time.Sleep(1 * time.Second)
-	}
-	if !networkUp {
-		// we will bail if we didn't get an address since if we plan on bootstrapping we won't get far
-		if buffer != nil {
-			buffer.Enqueue(OutgoingMessage{ID: id, Message: "no ip detected", Success: false})
-		}
-		return
-	}
 
-	if buffer != nil {
-		buffer.Enqueue(OutgoingMessage{ID: id, Message: "network is up", Success: true})
+		if len(addresses) == 0 {
+			time.Sleep(1 * time.Second)
+		}
 	}
 
-	BootstrapContainer(buffer, msg.Data["host"], msg.Data["name"])
+	return addresses, nil
 }
 
 // setupContainerNetwork looks at the OS of a container and then looks up any network template in our config.
 // It then parses that template through text/template passing the IP and uploads it to the container
-func setupContainerNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, name string, ip string) {
+func setupContainerNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string, ip string) error {
 	id := time.Now().UnixNano()
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Configuring container networking", Success: true})
@@ -146,12 +304,12 @@ func setupContainerNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage
 	// Even though we just created it, lxd doesn't give us a lot of info back about the image, etc.
 	// hell the GetImages call doesn't give us back a lot either.  So we are going to pull the container state
 	// to be able to figure out what OS we are on, so we can then use the right network setup
-	containerInfo, err := lxd.GetContainers(host, name, true)
+	containerInfo, err := lxd.GetContainers(host, project, name, true)
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
 		}
-		return
+		return err
 	}
 
 	// Given the OS reported by LXD, check to see if we have any networking config defined, and if so loop
@@ -165,22 +323,24 @@ func setupContainerNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage
 				if buffer != nil {
 					buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
 				}
-				return
+				return err
 			}
 			tmpl.Execute(&contents, map[string]interface{}{
 				"IP": ip,
 			})
 
-			err = lxd.CreateFile(host, name, file.RemotePath, 0644, contents.String())
+			err = lxd.CreateFile(host, project, name, file.RemotePath, 0644, contents.String())
 			if err != nil {
 				if buffer != nil {
 					buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
 				}
-				return
+				return err
 			}
 			if buffer != nil {
 				buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
 			}
 		}
 	}
+
+	return nil
 }
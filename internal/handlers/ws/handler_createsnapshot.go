@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// CreateSnapshotHandler takes a snapshot of a container, optionally stateful, and reports back how it went
+func CreateSnapshotHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Creating snapshot", Success: true})
+	}
+
+	err := lxd.CreateSnapshot(msg.Data["host"], msg.Data["project"], msg.Data["name"], msg.Data["snapshot"], msg.Data["stateful"] == "true")
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
+	}
+}
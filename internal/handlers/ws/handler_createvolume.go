@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// CreateVolumeHandler creates a custom storage volume that can be attached to containers
+func CreateVolumeHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Creating volume " + msg.Data["volume"] + " on " + msg.Data["pool"], Success: true})
+	}
+
+	err := lxd.CreateStorageVolume(msg.Data["host"], msg.Data["project"], msg.Data["pool"], msg.Data["volume"], msg.Data["size"])
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: "/storage"})
+	}
+}
@@ -27,7 +27,7 @@ func DeleteContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessag
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Deleting container", Success: true})
 	}
 
-	err = lxd.DeleteContainer(msg.Data["host"], msg.Data["name"])
+	err = lxd.DeleteContainer(msg.Data["host"], msg.Data["project"], msg.Data["name"])
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
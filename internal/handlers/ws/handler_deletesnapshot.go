@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// DeleteSnapshotHandler removes a snapshot from a container
+func DeleteSnapshotHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Deleting snapshot " + msg.Data["snapshot"], Success: true})
+	}
+
+	err := lxd.DeleteSnapshot(msg.Data["host"], msg.Data["project"], msg.Data["name"], msg.Data["snapshot"])
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
+	}
+}
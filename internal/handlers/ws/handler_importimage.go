@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// ImportImageHandler downloads an image from a public image server to one of our hosts, reporting the download
+// progress as it goes
+func ImportImageHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Importing image " + msg.Data["image"] + " from " + msg.Data["server"], Success: true})
+	}
+
+	err := lxd.ImportImage(msg.Data["host"], msg.Data["server"], msg.Data["protocol"], msg.Data["image"], msg.Data["alias"], progressReporter(buffer, id))
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: "/images"})
+	}
+}
+
+// ImportImageFileHandler creates an image from tarballs that were uploaded to us and saved at metaPath and
+// rootfsPath (blank for a unified tarball).  The files are removed once we are done with them.  Uploads come in over
+// http so this isn't called from our websocket, but it still reports back to the browser that uploaded it
+func ImportImageFileHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, alias string, metaName string, metaPath string, rootfsName string, rootfsPath string) {
+	defer os.Remove(metaPath)
+	if rootfsPath != "" {
+		defer os.Remove(rootfsPath)
+	}
+
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Importing image file " + metaName, Success: true})
+	}
+
+	meta, err := os.Open(metaPath)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+	defer meta.Close()
+
+	// split images have the rootfs as a second file
+	var rootfs io.Reader
+	if rootfsPath != "" {
+		f, err := os.Open(rootfsPath)
+		if err != nil {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+			}
+			return
+		}
+		defer f.Close()
+		rootfs = f
+	}
+
+	err = lxd.ImportImageFile(host, alias, meta, metaName, rootfs, rootfsName, progressReporter(buffer, id))
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: "/images"})
+	}
+}
@@ -1,20 +1,156 @@
 package ws
 
 import (
+	"strings"
 	"time"
 
 	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/dns"
 	"github.com/neophenix/lxdepot/internal/lxd"
 )
 
-// MoveContainerHandler wraps lxd.MoveContainer and reports any errors it returns
+// MoveContainerHandler moves a container to another host.  The default is an offline move where we stop the container,
+// copy it, remove it from the source and start it on the destination.  If live is set we instead ask LXD to migrate
+// the running container, which needs CRIU on both hosts.  If dst_member is set the move is to another member of the
+// cluster the container is in, which LXD handles itself.  Afterwards we make sure the container still has the address
+// DNS says it should, and if not rewrite its network config.
 func MoveContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	srcHost := msg.Data["host"]
+	dstHost := msg.Data["dst_host"]
+	dstMember := msg.Data["dst_member"]
+	project := msg.Data["project"]
+	name := msg.Data["name"]
+	live := msg.Data["mode"] == "live"
+
+	// cluster members all come from the same config entry
+	if dstMember != "" {
+		dstHost = srcHost
+	}
+
+	containerInfo, err := lxd.GetContainers(srcHost, project, name, false)
+	if err != nil {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed to get container info: " + err.Error(), Success: false})
+		}
+		return
+	}
+	if len(containerInfo) == 0 {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "container does not exist", Success: false})
+		}
+		return
+	}
+	wasRunning := containerInfo[0].Container.Status == "Running"
+
+	// Offline moves need the container stopped first
+	// -------------------------
+	if !live && wasRunning {
+		err = stopContainer(buffer, srcHost, project, name)
+		if err != nil {
+			return
+		}
+	}
+	// -------------------------
+
+	// Move the container
+	// -------------------------
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		mode := "offline"
+		if live {
+			mode = "live"
+		}
+		dst := dstHost
+		if dstMember != "" {
+			dst = dstMember
+		}
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Moving container (" + mode + ") to " + dst, Success: true})
+	}
+
+	if dstMember != "" {
+		err = lxd.MoveClusterMember(srcHost, project, name, dstMember, live)
+	} else {
+		err = lxd.MoveContainer(srcHost, dstHost, project, name, live)
+	}
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+
+		// lxd.MoveContainer cleans up the destination (and a cluster move leaves nothing behind), if we stopped the
+		// container put it back the way it was
+		if !live && wasRunning {
+			StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": srcHost, "project": project, "name": name}})
+		}
+		return
+	}
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+	}
+	// -------------------------
+
+	// Nothing more to do if the container wasn't running, we will check networking the next time it starts
+	if !wasRunning {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(dstHost, project, name)})
+		}
+		return
+	}
+
+	if !live {
+		err = StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": dstHost, "project": project, "name": name}})
+		if err != nil {
+			return
+		}
+	}
+
+	verifyMovedNetwork(buffer, dstHost, project, name)
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(dstHost, project, name)})
+	}
+}
+
+// verifyMovedNetwork waits for the container to come up on its new host and compares its address with the one
+// DNS has for it.  If they differ we upload the network config again and restart the container.  With DHCP
+// there is nothing to compare against so we just report what address it ended up with.
+func verifyMovedNetwork(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string) {
 	id := time.Now().UnixNano()
 	if buffer != nil {
-		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Moving container", Success: true})
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Verifying networking", Success: true})
+	}
+
+	addresses, err := waitForNetwork(host, project, name)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+
+	if strings.ToLower(Conf.DNS.Provider) == "dhcp" {
+		if len(addresses) == 0 {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: "no ip detected", Success: false})
+			}
+		} else if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: strings.Join(addresses, ", "), Success: true})
+		}
+		return
 	}
 
-	err := lxd.MoveContainer(msg.Data["host"], msg.Data["dst_host"], msg.Data["name"])
+	d := dns.New(Conf)
+	if d == nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed to create DNS object for provider: " + Conf.DNS.Provider, Success: false})
+		}
+		return
+	}
+
+	// GetARecord hands back the existing record, or makes a new one if it somehow went missing
+	ip, err := d.GetARecord(name, Conf.DNS.NetworkBlocks)
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -22,8 +158,51 @@ func MoveContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage]
 		return
 	}
 
+	for _, addr := range addresses {
+		if addr == ip {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: ip, Success: true})
+			}
+			return
+		}
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "address does not match DNS (" + ip + "), reconfiguring", Success: false})
+	}
+
+	err = setupContainerNetwork(buffer, host, project, name, ip)
+	if err != nil {
+		return
+	}
+
+	// restart so the new config is picked up
+	err = stopContainer(buffer, host, project, name)
+	if err != nil {
+		return
+	}
+	err = StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": host, "project": project, "name": name}})
+	if err != nil {
+		return
+	}
+
+	addresses, err = waitForNetwork(host, project, name)
+	id = time.Now().UnixNano()
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return
+	}
+	for _, addr := range addresses {
+		if addr == ip {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: "network is up with " + ip, Success: true})
+			}
+			return
+		}
+	}
 	if buffer != nil {
-		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: false})
-		buffer.Enqueue(OutgoingMessage{Redirect: "/container/" + msg.Data["host"] + ":" + msg.Data["name"]})
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "container still does not have " + ip, Success: false})
 	}
 }
@@ -0,0 +1,31 @@
+package ws
+
+import (
+	"strings"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// RefreshInventoryHandler refreshes the whole inventory right away instead of waiting on the background refresh,
+// then sends the user back to the page they were on
+func RefreshInventoryHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Refreshing inventory", Success: true})
+	}
+
+	lxd.RefreshInventory()
+
+	// only send them somewhere on our own site
+	page := msg.Data["page"]
+	if !strings.HasPrefix(page, "/") || strings.HasPrefix(page, "//") {
+		page = "/containers"
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+		buffer.Enqueue(OutgoingMessage{Redirect: page})
+	}
+}
@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"strings"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/circularbuffer"
+	"github.com/neophenix/lxdepot/internal/dns"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// RenameContainerHandler stops the container if it is running, renames it, moves its DNS record to the new name
+// if we are using a 3rd party DNS, and then starts it back up if it was running before
+func RenameContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage], msg IncomingMessage) {
+	host := msg.Data["host"]
+	project := msg.Data["project"]
+	name := msg.Data["name"]
+	newName := msg.Data["new_name"]
+
+	containerInfo, err := lxd.GetContainers(host, project, name, false)
+	if err != nil {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed to get container info: " + err.Error(), Success: false})
+		}
+		return
+	}
+	if len(containerInfo) == 0 {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "container does not exist", Success: false})
+		}
+		return
+	}
+	if !lxd.IsManageable(containerInfo[0]) {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "lock flag set, remote management denied", Success: false})
+		}
+		return
+	}
+	if newName == "" || newName == name {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "a new name for the container is required", Success: false})
+		}
+		return
+	}
+	wasRunning := containerInfo[0].Container.Status == "Running"
+
+	if wasRunning {
+		err = stopContainer(buffer, host, project, name)
+		if err != nil {
+			return
+		}
+	}
+
+	// Rename the container
+	// -------------------------
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Renaming container to " + newName, Success: true})
+	}
+
+	err = lxd.RenameContainer(host, project, name, newName)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		// put it back the way we found it
+		if wasRunning {
+			StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": host, "project": project, "name": name}})
+		}
+		return
+	}
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+	}
+	// -------------------------
+
+	// DNS if we aren't using DHCP.  The container keeps its address, so a failure here isn't fatal but the
+	// user will need to fix the record up by hand
+	// -------------------------
+	if strings.ToLower(Conf.DNS.Provider) != "dhcp" {
+		id := time.Now().UnixNano()
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "Moving DNS entry", Success: true})
+		}
+
+		d := dns.New(Conf)
+		if d == nil {
+			if buffer != nil {
+				buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed to create DNS object for provider: " + Conf.DNS.Provider, Success: false})
+			}
+		} else {
+			err := d.RenameARecord(name, newName)
+			if err != nil {
+				if buffer != nil {
+					buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+				}
+			} else {
+				if buffer != nil {
+					buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+				}
+			}
+		}
+	}
+	// -------------------------
+
+	if wasRunning {
+		err = StartContainerHandler(buffer, IncomingMessage{Data: map[string]string{"host": host, "project": project, "name": newName}})
+		if err != nil {
+			return
+		}
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(host, project, newName)})
+	}
+}
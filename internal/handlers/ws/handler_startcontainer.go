@@ -15,7 +15,7 @@ func StartContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Starting container", Success: true})
 	}
 
-	err := lxd.StartContainer(msg.Data["host"], msg.Data["name"])
+	err := lxd.StartContainer(msg.Data["host"], msg.Data["project"], msg.Data["name"])
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -25,7 +25,7 @@ func StartContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage
 
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
-		buffer.Enqueue(OutgoingMessage{Redirect: "/container/" + msg.Data["host"] + ":" + msg.Data["name"]})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
 	}
 
 	return nil
@@ -15,7 +15,7 @@ func StopContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage]
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Stopping container", Success: true})
 	}
 
-	err := lxd.StopContainer(msg.Data["host"], msg.Data["name"])
+	err := lxd.StopContainer(msg.Data["host"], msg.Data["project"], msg.Data["name"])
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -25,8 +25,30 @@ func StopContainerHandler(buffer *circularbuffer.CircularBuffer[OutgoingMessage]
 
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
-		buffer.Enqueue(OutgoingMessage{Redirect: "/container/" + msg.Data["host"] + ":" + msg.Data["name"]})
+		buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(msg.Data["host"], msg.Data["project"], msg.Data["name"])})
 	}
 
 	return nil
 }
+
+// stopContainer stops the container like StopContainerHandler, but doesn't suggest a redirect since the caller
+// still has more to do
+func stopContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string) error {
+	id := time.Now().UnixNano()
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Stopping container", Success: true})
+	}
+
+	err := lxd.StopContainer(host, project, name)
+	if err != nil {
+		if buffer != nil {
+			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
+		}
+		return err
+	}
+
+	if buffer != nil {
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: "done", Success: true})
+	}
+	return nil
+}
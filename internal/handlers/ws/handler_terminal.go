@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// terminalCommand is what we run for a terminal, a login bash if the container has it otherwise sh
+var terminalCommand = []string{"/bin/sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash -l; else exec sh -l; fi"}
+
+// Unlike our message websocket a terminal is a shell on someones container, so we use the default origin
+// check which makes sure the request came from a page we served
+var terminalUpgrader = websocket.Upgrader{}
+
+// terminalControl is a text message from the browser, binary messages are all keyboard input
+type terminalControl struct {
+	Type string `json:"type"` // only resize for now
+	lxd.TerminalSize
+}
+
+// terminalWriter sends container output to the browser as binary messages
+type terminalWriter struct {
+	conn *websocket.Conn
+	lock sync.Mutex
+}
+
+// Write sends the data along as a single binary message
+func (t *terminalWriter) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	err := t.conn.WriteMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close does nothing, the handler closes the websocket when it is done
+func (t *terminalWriter) Close() error {
+	return nil
+}
+
+// TerminalHandler bridges a websocket from the terminal page to an interactive shell on the container.
+// The container is given by the host, project and name query params, with cols and rows for the initial size.
+func TerminalHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	project := r.URL.Query().Get("project")
+	name := r.URL.Query().Get("name")
+	size := lxd.TerminalSize{Width: 80, Height: 24}
+	if cols, err := strconv.Atoi(r.URL.Query().Get("cols")); err == nil && cols > 0 {
+		size.Width = cols
+	}
+	if rows, err := strconv.Atoi(r.URL.Query().Get("rows")); err == nil && rows > 0 {
+		size.Height = rows
+	}
+
+	conn, err := terminalUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print("terminal upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	log.Printf("terminal opened on container %v by %v\n", name, r.RemoteAddr)
+
+	stdinReader, stdinWriter := io.Pipe()
+	resize := make(chan lxd.TerminalSize, 1)
+	hangup := make(chan struct{})
+	output := &terminalWriter{conn: conn}
+
+	// read from the browser until it goes away, passing keyboard input to the shell and resizes to the control channel
+	go func() {
+		defer close(hangup)
+		defer stdinWriter.Close()
+		for {
+			mtype, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if mtype == websocket.BinaryMessage {
+				_, err = stdinWriter.Write(data)
+				if err != nil {
+					return
+				}
+			} else {
+				var ctrl terminalControl
+				err = json.Unmarshal(data, &ctrl)
+				if err == nil && ctrl.Type == "resize" && ctrl.Width > 0 && ctrl.Height > 0 {
+					// only the latest size matters, so if one is still waiting replace it
+					select {
+					case <-resize:
+					default:
+					}
+					resize <- ctrl.TerminalSize
+				}
+			}
+		}
+	}()
+
+	rv, err := lxd.ExecTerminal(host, project, name, terminalCommand, stdinReader, output, size, resize, hangup)
+	// nothing is reading input anymore, make sure our reader doesn't block trying to pass it along
+	stdinReader.Close()
+	if err != nil {
+		output.Write([]byte("\r\n" + err.Error() + "\r\n"))
+	} else {
+		output.Write([]byte("\r\nsession ended (" + strconv.FormatFloat(rv, 'f', -1, 64) + ")\r\n"))
+	}
+
+	log.Printf("terminal closed on container %v by %v\n", name, r.RemoteAddr)
+
+	output.lock.Lock()
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	output.lock.Unlock()
+}
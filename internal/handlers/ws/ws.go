@@ -4,11 +4,13 @@
 package ws
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -29,15 +31,90 @@ type IncomingMessage struct {
 
 // OutgoingMessage is from us to the UI
 type OutgoingMessage struct {
-	ID       int64  // ID to keep messages and their status together
-	Message  string // message to show the user
-	Success  bool   // success is used to give a visual hint to the user how the command went (true = green, false = red)
-	Redirect string // If we want to suggest a redirect to another page, like back to /containers after we create a new one
+	ID       int64               // ID to keep messages and their status together
+	Message  string              // message to show the user
+	Success  bool                // success is used to give a visual hint to the user how the command went (true = green, false = red)
+	Redirect string              // If we want to suggest a redirect to another page, like back to /containers after we create a new one
+	Stream   string              // For command output, which stream the line came from: stdout or stderr
+	Event    *lxd.ContainerEvent // A container lifecycle change from one of the hosts, sent to every browser
+}
+
+// outputChunkSize is how much command output we gather up before sending it along as one message
+const outputChunkSize = 4096
+
+// outputChunkWait is the longest we hold on to command output before sending it along, so slow output still shows up
+const outputChunkWait = 500 * time.Millisecond
+
+// outputWriter gathers command output into chunks of whole lines and sends them to an output buffer.  Output goes
+// in its own buffer so a chatty command can only push out older output, never the step status or redirect messages
+type outputWriter struct {
+	buffer  *circularbuffer.CircularBuffer[OutgoingMessage] // output buffer from getOutputBuffer
+	stream  string                                          // stdout or stderr
+	partial []byte                                          // anything we have received that isn't a full line yet
+	pending []byte                                          // full lines waiting to be sent
+	timer   *time.Timer                                     // sends pending once outputChunkWait is up
+	lock    sync.Mutex
+}
+
+// Write adds every complete line to what we are about to send, sending once we have a chunk worth, and holds on to
+// the rest
+func (o *outputWriter) Write(b []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.partial = append(o.partial, b...)
+	if idx := bytes.LastIndexByte(o.partial, '\n'); idx >= 0 {
+		o.pending = append(o.pending, o.partial[:idx+1]...)
+		o.partial = o.partial[idx+1:]
+	}
+
+	if len(o.pending) >= outputChunkSize {
+		o.send()
+	} else if len(o.pending) > 0 && o.timer == nil {
+		o.timer = time.AfterFunc(outputChunkWait, func() {
+			o.lock.Lock()
+			defer o.lock.Unlock()
+			o.send()
+		})
+	}
+
+	return len(b), nil
+}
+
+// Flush sends along everything we are holding on to, including any partial line
+func (o *outputWriter) Flush() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.pending = append(o.pending, o.partial...)
+	o.partial = nil
+	o.send()
+}
+
+// send puts everything pending in the buffer as one message, the caller holds the lock.  Every chunk gets its own ID
+// so the UI shows them all
+func (o *outputWriter) send() {
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+	}
+	if len(o.pending) == 0 {
+		return
+	}
+
+	if o.buffer != nil {
+		output := strings.TrimRight(strings.ReplaceAll(string(o.pending), "\r\n", "\n"), "\n")
+		o.buffer.Enqueue(OutgoingMessage{ID: time.Now().UnixNano(), Message: output, Success: true, Stream: o.stream})
+	}
+	o.pending = nil
 }
 
 // MessageBuffer will house our outgoing messages so clients can navigate around and get updates
 var MessageBuffer = map[string]*circularbuffer.CircularBuffer[OutgoingMessage]{}
 
+// message buffer -> the buffer command output for that browser goes in
+var outputBuffers = map[*circularbuffer.CircularBuffer[OutgoingMessage]]*circularbuffer.CircularBuffer[OutgoingMessage]{}
+
 // mutex for our message buffer map
 var mutex = &sync.RWMutex{}
 
@@ -60,6 +137,12 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer conn.Close()
+
+	events := subscribeEvents()
+	defer unsubscribeEvents(events)
+
+	// we only want one consumer per connection, the websocket doesn't allow concurrent writes
+	consuming := false
 	for {
 		// read out message and unmarshal it, log out what it was for debugging.
 		_, encmsg, err := conn.ReadMessage()
@@ -75,22 +158,21 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		var buffer *circularbuffer.CircularBuffer[OutgoingMessage]
-		if msg.BrowserID != "" && msg.BrowserID != "none" {
-			// make sure we have a buffer setup for this id
-			var ok bool
-			mutex.Lock()
-			if buffer, ok = MessageBuffer[msg.BrowserID]; !ok {
-				buffer = &circularbuffer.CircularBuffer[OutgoingMessage]{}
-				MessageBuffer[msg.BrowserID] = buffer
-			}
-			mutex.Unlock()
+		// everything from before we knew about projects lives in the default project
+		if msg.Data == nil {
+			msg.Data = make(map[string]string)
+		}
+		if msg.Data["project"] == "" {
+			msg.Data["project"] = "default"
 		}
 
-		// any action is going to kickstart consuming messages in the background
-		go func() {
-			consumeMessages(conn, buffer)
-		}()
+		buffer := GetMessageBuffer(msg.BrowserID)
+
+		// the first action is going to kickstart consuming messages in the background
+		if !consuming {
+			consuming = true
+			go consumeMessages(conn, buffer, getOutputBuffer(buffer), events)
+		}
 
 		// Action tells us what we want to do, so this is a pretty simple router for the various requests
 		// Each handler should be in its own handler_* file in the ws package
@@ -103,10 +185,48 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			CreateContainerHandler(buffer, msg)
 		case "delete":
 			DeleteContainerHandler(buffer, msg)
+		case "clone":
+			CloneContainerHandler(buffer, msg)
+		case "rename":
+			RenameContainerHandler(buffer, msg)
 		case "move":
 			MoveContainerHandler(buffer, msg)
 		case "playbook":
 			ContainerPlaybookHandler(buffer, msg)
+		case "create_snapshot":
+			CreateSnapshotHandler(buffer, msg)
+		case "restore_snapshot":
+			RestoreSnapshotHandler(buffer, msg)
+		case "delete_snapshot":
+			DeleteSnapshotHandler(buffer, msg)
+		case "add_device":
+			AddDeviceHandler(buffer, msg)
+		case "remove_device":
+			RemoveDeviceHandler(buffer, msg)
+		case "add_profile":
+			AddProfileHandler(buffer, msg)
+		case "remove_profile":
+			RemoveProfileHandler(buffer, msg)
+		case "import_image":
+			ImportImageHandler(buffer, msg)
+		case "copy_image":
+			CopyImageHandler(buffer, msg)
+		case "delete_image":
+			DeleteImageHandler(buffer, msg)
+		case "add_image_alias":
+			AddImageAliasHandler(buffer, msg)
+		case "remove_image_alias":
+			RemoveImageAliasHandler(buffer, msg)
+		case "sync_images":
+			SyncImagesHandler(buffer, msg)
+		case "create_volume":
+			CreateVolumeHandler(buffer, msg)
+		case "resize_volume":
+			ResizeVolumeHandler(buffer, msg)
+		case "delete_volume":
+			DeleteVolumeHandler(buffer, msg)
+		case "refresh_inventory":
+			RefreshInventoryHandler(buffer, msg)
 		case "consume":
 			// a noop since we always kickstart consuming when we get a message
 		default:
@@ -118,34 +238,122 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func consumeMessages(conn *websocket.Conn, buffer *circularbuffer.CircularBuffer[OutgoingMessage]) {
-	if buffer != nil {
-		pingWait := 0
-		for {
-			msg, ok := buffer.Dequeue()
-			if ok {
-				data, err := json.Marshal(msg)
-				if err == nil {
-					// outgoing messages should always be of a TextMessage type
-					err := conn.WriteMessage(websocket.TextMessage, data)
-					if err != nil {
-						// we lost the message, probably because the connection went away, so we will stop consuming
-						break
-					}
+// GetMessageBuffer returns the message buffer for a browser, creating it if this is the first we have heard from it.
+// Browsers without an ID get nil, and nothing is sent back to them
+func GetMessageBuffer(browserID string) *circularbuffer.CircularBuffer[OutgoingMessage] {
+	if browserID == "" || browserID == "none" {
+		return nil
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	buffer, ok := MessageBuffer[browserID]
+	if !ok {
+		buffer = &circularbuffer.CircularBuffer[OutgoingMessage]{}
+		MessageBuffer[browserID] = buffer
+	}
+
+	return buffer
+}
+
+// getOutputBuffer returns the buffer command output goes in for the browser with this message buffer, creating it the
+// first time.  Like message buffers a nil buffer gets nil
+func getOutputBuffer(buffer *circularbuffer.CircularBuffer[OutgoingMessage]) *circularbuffer.CircularBuffer[OutgoingMessage] {
+	if buffer == nil {
+		return nil
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	output, ok := outputBuffers[buffer]
+	if !ok {
+		output = &circularbuffer.CircularBuffer[OutgoingMessage]{}
+		outputBuffers[buffer] = output
+	}
+
+	return output
+}
+
+// progressReporter returns a func that updates the status of the message with the given id as a long running
+// operation makes progress.  Updates are limited to every couple seconds so we don't push everything else out
+// of the buffer
+func progressReporter(buffer *circularbuffer.CircularBuffer[OutgoingMessage], id int64) func(string) {
+	var last time.Time
+	var lock sync.Mutex
+
+	return func(progress string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if buffer == nil || progress == "" || time.Since(last) < 2*time.Second {
+			return
+		}
+		last = time.Now()
+		buffer.Enqueue(OutgoingMessage{ID: id, Message: progress, Success: true})
+	}
+}
+
+// nextMessage takes the message from whichever of the message and output buffers was written first, so output shows
+// up between the steps it came from
+func nextMessage(buffer *circularbuffer.CircularBuffer[OutgoingMessage], output *circularbuffer.CircularBuffer[OutgoingMessage]) (OutgoingMessage, bool) {
+	if buffer == nil {
+		return OutgoingMessage{}, false
+	}
+
+	seq, ok := buffer.Oldest()
+	outputSeq, outputOk := output.Oldest()
+	if outputOk && (!ok || outputSeq < seq) {
+		return output.Dequeue()
+	}
+
+	return buffer.Dequeue()
+}
+
+// ContainerURL is the page for a container, we redirect there once we are done with it and the config page does too
+func ContainerURL(host string, project string, name string) string {
+	return "/container/" + host + ":" + name + "?project=" + url.QueryEscape(project)
+}
+
+// consumeMessages sends our messages, command output and any events to the browser until the connection goes away.
+// Events don't go through the buffer, they are only interesting to whatever page is open right now
+func consumeMessages(conn *websocket.Conn, buffer *circularbuffer.CircularBuffer[OutgoingMessage], output *circularbuffer.CircularBuffer[OutgoingMessage], events chan OutgoingMessage) {
+	pingWait := 0
+	for {
+		var msg OutgoingMessage
+		ok := false
+		select {
+		case msg = <-events:
+			ok = true
+		default:
+			msg, ok = nextMessage(buffer, output)
+		}
+		if ok {
+			data, err := json.Marshal(msg)
+			if err == nil {
+				// outgoing messages should always be of a TextMessage type
+				err := conn.WriteMessage(websocket.TextMessage, data)
+				if err != nil {
+					// we lost the message, probably because the connection went away, so we will stop consuming
+					break
 				}
-			} else {
-				pingWait++
-				// 4 since we sleep for 250ms then the number of seconds we want to wait
-				if pingWait == 4*10 {
-					err := conn.WriteMessage(websocket.PingMessage, nil)
-					if err != nil {
-						// connection likely broken here, stop consuming
-						break
-					}
-					pingWait = 0
+			}
+		} else {
+			pingWait++
+			// 4 since we sleep for 250ms then the number of seconds we want to wait
+			if pingWait == 4*10 {
+				err := conn.WriteMessage(websocket.PingMessage, nil)
+				if err != nil {
+					// connection likely broken here, stop consuming
+					break
 				}
+				pingWait = 0
 			}
-			// if we have nothing to consume, wait some amount of time, 1/4 second seems like a good start
+		}
+		// keep sending while we have messages, command output can come in faster than we used to consume it.
+		// If we have nothing to consume, wait some amount of time, 1/4 second seems like a good start
+		if !ok {
 			time.Sleep(250 * time.Millisecond)
 		}
 	}
@@ -153,14 +361,14 @@ func consumeMessages(conn *websocket.Conn, buffer *circularbuffer.CircularBuffer
 
 // BootstrapContainer loops over all the FileOrCommand objects in the bootstrap section of the config
 // and performs each item sequentially
-func BootstrapContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, name string) {
+func BootstrapContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string) {
 	id := time.Now().UnixNano()
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Getting container state", Success: true})
 	}
 
 	// Get the container state again, should probably just grab this once but for now lets be expensive
-	containerInfo, err := lxd.GetContainers(host, name, true)
+	containerInfo, err := lxd.GetContainers(host, project, name, true)
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -178,19 +386,19 @@ func BootstrapContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage],
 			for _, step := range bootstrap {
 				// depending on the type, call the appropriate helper
 				if step.Type == "file" {
-					err = containerCreateFile(buffer, host, name, step)
+					err = containerCreateFile(buffer, host, project, name, step)
 					if err != nil {
 						return
 					}
 				} else if step.Type == "command" {
-					err = containerExecCommand(buffer, host, name, step)
+					err = containerExecCommand(buffer, host, project, name, step)
 					if err != nil {
 						return
 					}
 				}
 			}
 			if buffer != nil {
-				buffer.Enqueue(OutgoingMessage{Redirect: "/container/" + host + ":" + name})
+				buffer.Enqueue(OutgoingMessage{Redirect: ContainerURL(host, project, name)})
 			}
 		}()
 	}
@@ -199,7 +407,7 @@ func BootstrapContainer(buffer *circularbuffer.CircularBuffer[OutgoingMessage],
 // containerCreateFile operates on a Type = file bootstrap / playbook step.
 // If there is a local_path, it reads the contents of that file from disk.
 // The contents are then sent to the lxd.CreateFile with the path on the container and permissions to "do the right thing"
-func containerCreateFile(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, name string, info config.FileOrCommand) error {
+func containerCreateFile(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string, info config.FileOrCommand) error {
 	id := time.Now().UnixNano()
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Creating " + info.RemotePath, Success: true})
@@ -220,7 +428,7 @@ func containerCreateFile(buffer *circularbuffer.CircularBuffer[OutgoingMessage],
 		}
 	}
 
-	err = lxd.CreateFile(host, name, info.RemotePath, info.Perms, string(contents))
+	err = lxd.CreateFile(host, project, name, info.RemotePath, info.Perms, string(contents))
 	if err != nil {
 		if buffer != nil {
 			buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -235,8 +443,8 @@ func containerCreateFile(buffer *circularbuffer.CircularBuffer[OutgoingMessage],
 }
 
 // containerExecCommand operates on a Type = command bootstrap / playbook step.
-// This is really just a wrapper around lxd.ExecCommand
-func containerExecCommand(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, name string, info config.FileOrCommand) error {
+// This is really just a wrapper around lxd.ExecCommand that streams the output to the UI
+func containerExecCommand(buffer *circularbuffer.CircularBuffer[OutgoingMessage], host string, project string, name string, info config.FileOrCommand) error {
 	id := time.Now().UnixNano()
 	if buffer != nil {
 		buffer.Enqueue(OutgoingMessage{ID: id, Message: "Executing " + strings.Join(info.Command, " "), Success: true})
@@ -250,7 +458,11 @@ func containerExecCommand(buffer *circularbuffer.CircularBuffer[OutgoingMessage]
 	var rv float64
 	var err error
 	for !success && attempt <= 2 {
-		rv, err = lxd.ExecCommand(host, name, info.Command)
+		stdout := &outputWriter{buffer: getOutputBuffer(buffer), stream: "stdout"}
+		stderr := &outputWriter{buffer: getOutputBuffer(buffer), stream: "stderr"}
+		rv, err = lxd.ExecCommand(host, project, name, info.Command, stdout, stderr)
+		stdout.Flush()
+		stderr.Flush()
 		if err != nil {
 			if buffer != nil {
 				buffer.Enqueue(OutgoingMessage{ID: id, Message: "failed: " + err.Error(), Success: false})
@@ -297,6 +509,7 @@ func ManageBuffers() {
 				for id, buffer := range MessageBuffer {
 					if !buffer.HasRecentAccess() {
 						delete(MessageBuffer, id)
+						delete(outputBuffers, buffer)
 					}
 				}
 				mutex.Unlock()
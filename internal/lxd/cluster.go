@@ -0,0 +1,112 @@
+package lxd
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// ClusterMemberInfo is the subset of a cluster members details we show in the UI
+type ClusterMemberInfo struct {
+	Name         string   // server name of the member, this is what instances have as their location
+	URL          string   // address the member listens on
+	Status       string   // Online, Offline, Evacuated, etc
+	Message      string   // more detail on the status
+	Architecture string   // x86_64, etc
+	Roles        []string // database, event-hub, etc
+}
+
+// GetClusterMembers gets the members of the cluster for each host, hosts that aren't clustered are left out.
+// Listing one member of a cluster in the config is enough to find the rest
+func GetClusterMembers(host string) (map[string][]ClusterMemberInfo, error) {
+	memberMap := make(map[string][]ClusterMemberInfo)
+
+	for _, lxdh := range Conf.LXDhosts {
+		if host == "" || lxdh.Host == host {
+			conn, err := getConnection(lxdh.Host, "")
+			if err != nil {
+				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			if !conn.IsClustered() {
+				continue
+			}
+
+			members, err := conn.GetClusterMembers()
+			if err != nil {
+				log.Printf("Error getting cluster members from " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			for _, m := range members {
+				memberMap[lxdh.Host] = append(memberMap[lxdh.Host], ClusterMemberInfo{
+					Name:         m.ServerName,
+					URL:          m.URL,
+					Status:       m.Status,
+					Message:      m.Message,
+					Architecture: m.Architecture,
+					Roles:        m.Roles,
+				})
+			}
+		}
+	}
+
+	return memberMap, nil
+}
+
+// MoveClusterMember moves a container to another member of the cluster it is in.  Unlike MoveContainer we let LXD
+// do all the work, so we don't shuttle any data ourselves and there is nothing to clean up if it fails.  Like
+// MoveContainer the container should be stopped, or running for a live move which needs CRIU on both members
+func MoveClusterMember(host string, project string, name string, member string, live bool) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	if !conn.IsClustered() {
+		return errors.New(host + " is not part of a cluster")
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	container, _, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+
+	if container.Location == member {
+		return errors.New("container is already on " + member)
+	}
+
+	if live && container.Status != "Running" {
+		return errors.New("live moves need a running container")
+	} else if !live && container.Status != "Stopped" {
+		return errors.New("container must be stopped before moving")
+	}
+
+	req := api.InstancePost{
+		Name:      name,
+		Migration: true,
+		Live:      live,
+	}
+
+	op, err := conn.UseTarget(member).MigrateInstance(name, req)
+	if err != nil {
+		return err
+	}
+
+	err = op.Wait()
+	if err != nil {
+		return err
+	}
+
+	// the container has a new location
+	refreshInventoryContainer(host, project, name)
+
+	return nil
+}
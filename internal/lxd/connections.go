@@ -0,0 +1,181 @@
+package lxd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+// hostConnection is our cached connection to a single LXD host.  Each host has its own lock so a host that is slow
+// to answer only holds up the callers that want that host
+type hostConnection struct {
+	lock      sync.Mutex
+	conn      lxd.InstanceServer // nil until we connect, or after we find the connection is dead
+	checkedAt time.Time          // last time we know the connection worked
+}
+
+// cache of connections to our LXD servers, host -> connection
+var lxdConnections = make(map[string]*hostConnection)
+
+// mutex for our connection map, the connections themselves are protected by their own lock
+var connectionMutex = &sync.Mutex{}
+
+// connectionCheckInterval is how long we trust a cached connection before making sure it still works.  A host that
+// restarted or got a new certificate leaves us with a connection that just errors, this is how we notice
+const connectionCheckInterval = 30 * time.Second
+
+// connectTimeout is how long we wait on a host to answer when making a new connection
+const connectTimeout = 10 * time.Second
+
+// getConnection will either return a cached connection, or reach out and make a new connection
+// to the host before caching that.  The connection uses the given project, blank is the default project
+func getConnection(host string, project string) (lxd.InstanceServer, error) {
+	lxdh := getHost(host)
+	if lxdh == nil {
+		return nil, errors.New("could not find lxdhost [" + host + "] in config")
+	}
+	if err := checkProject(lxdh, project); err != nil {
+		return nil, err
+	}
+
+	hc := getHostConnection(host)
+
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	if hc.conn != nil {
+		if time.Since(hc.checkedAt) < connectionCheckInterval {
+			return useProject(hc.conn, project), nil
+		}
+
+		// it has been a bit, make sure the host is still talking to us before handing this back out
+		_, _, err := hc.conn.GetServer()
+		if err == nil {
+			hc.checkedAt = time.Now()
+			return useProject(hc.conn, project), nil
+		}
+
+		log.Printf("Connection to " + host + " failed its check, reconnecting : " + err.Error())
+		hc.conn.Disconnect()
+		hc.conn = nil
+	}
+
+	// the host may have a new certificate, which is often why we are reconnecting, so use whatever is on disk now
+	fromFile, err := lxdh.ReloadCert()
+	if err != nil {
+		log.Printf("Could not read the certificate for " + host + " again, using the one we have : " + err.Error())
+	}
+
+	args := &lxd.ConnectionArgs{
+		TLSClientCert: Conf.Cert,
+		TLSClientKey:  Conf.Key,
+		TLSServerCert: lxdh.Cert,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	conn, err := lxd.ConnectLXDWithContext(ctx, "https://"+lxdh.Host+":"+lxdh.Port, args)
+	if err != nil {
+		if !fromFile {
+			return nil, errors.New(err.Error() + " (the certificate for " + host + " is set in the config, if the host has a new one update it there and restart)")
+		}
+		return nil, err
+	}
+
+	hc.conn = conn
+	hc.checkedAt = time.Now()
+
+	return useProject(conn, project), nil
+}
+
+// expireConnection is for when something makes us think a host went away.  The next caller will check the
+// connection before using it, and reconnect if it is dead
+func expireConnection(host string) {
+	hc := getHostConnection(host)
+
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	hc.checkedAt = time.Time{}
+}
+
+// getHostConnection returns the cache entry for a host, creating an empty one the first time we see it
+func getHostConnection(host string) *hostConnection {
+	connectionMutex.Lock()
+	defer connectionMutex.Unlock()
+
+	hc, ok := lxdConnections[host]
+	if !ok {
+		hc = &hostConnection{}
+		lxdConnections[host] = hc
+	}
+
+	return hc
+}
+
+// checkProject makes sure the project is one we manage on the host, the project comes from the browser so without
+// this anyone could work with instances in projects we were told to leave alone
+func checkProject(lxdh *config.LXDhost, project string) error {
+	if project == "" || project == "default" {
+		return nil
+	}
+
+	for _, p := range lxdh.Projects {
+		if p == project {
+			return nil
+		}
+	}
+
+	return errors.New("project [" + project + "] is not managed on lxdhost [" + lxdh.Host + "]")
+}
+
+// getHost finds a host in our config, nil if we don't know about it
+func getHost(host string) *config.LXDhost {
+	for _, h := range Conf.LXDhosts {
+		if h.Host == host {
+			return h
+		}
+	}
+
+	return nil
+}
+
+// callWithContext runs f in the background and waits for it or ctx, whichever is first.  The client calls we make
+// don't take a context, so a call we give up on keeps going until it finishes on its own and its result goes nowhere
+func callWithContext[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	// buffered so an abandoned call can still send and go away
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// useProject points a connection at a project.  The cached connection always stays on the default project and
+// we hand out a copy for whichever project a caller needs
+func useProject(conn lxd.InstanceServer, project string) lxd.InstanceServer {
+	if project == "" || project == "default" {
+		return conn
+	}
+
+	return conn.UseProject(project)
+}
@@ -0,0 +1,82 @@
+package lxd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+func TestGetConnection(t *testing.T) {
+	Conf = &config.Config{LXDhosts: []*config.LXDhost{{Host: "host1", Port: "8443", Projects: []string{"default", "web"}}}}
+
+	// Test 1, hosts we don't know about are an error, not the end of the process
+	if _, err := getConnection("nope", ""); err == nil {
+		t.Errorf("T1: Expected an error for an unknown host")
+	}
+
+	// Test 2, everyone asking for a host at once gets the same cache entry
+	entries := make([]*hostConnection, 20)
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entries[i] = getHostConnection("host1")
+		}(i)
+	}
+	wg.Wait()
+	for i := range entries {
+		if entries[i] != entries[0] {
+			t.Errorf("T2: Expected one cache entry for host1, %v was different", i)
+		}
+	}
+
+	// Test 3, projects we don't manage on the host are refused before we try to connect
+	if _, err := getConnection("host1", "secret"); err == nil {
+		t.Errorf("T3: Expected an error for an unlisted project")
+	}
+}
+
+func TestCheckProject(t *testing.T) {
+	lxdh := &config.LXDhost{Host: "host1", Projects: []string{"web"}}
+
+	projects := map[string]bool{
+		"":        true,
+		"default": true,
+		"web":     true,
+		"secret":  false,
+		"Web":     false,
+	}
+	for project, ok := range projects {
+		if err := checkProject(lxdh, project); (err == nil) != ok {
+			t.Errorf("checkProject(%v): Expected allowed %v got %v", project, ok, err)
+		}
+	}
+}
+
+func TestCallWithContext(t *testing.T) {
+	// Test 1, calls that finish in time give back what they returned
+	v, err := callWithContext(context.Background(), func() (int, error) { return 1, nil })
+	if v != 1 || err != nil {
+		t.Errorf("T1: Expected 1 and no error got %v %v", v, err)
+	}
+
+	// Test 2, slow calls are given up on when the context is done, without waiting on them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = callWithContext(ctx, func() (int, error) {
+		time.Sleep(time.Second)
+		return 1, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("T2: Expected a deadline error got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("T2: Expected to give up quickly, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,155 @@
+package lxd
+
+import (
+	"bytes"
+	"io"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// LOGREADLEN is the most we will keep of a console or log file for display, these are meant for a quick
+// look at why something went wrong, not for downloading huge logs.  We keep the end, that is where the
+// interesting part usually is
+const LOGREADLEN = 1024 * 1024
+
+// LogFile is the name and contents of one of the log files LXD keeps for a container
+type LogFile struct {
+	Name      string // file name like lxc.log
+	Contents  string // contents, only the last LOGREADLEN bytes
+	Truncated bool   // whether there was more before Contents that we dropped
+}
+
+// GetConsoleLog returns what is in the console buffer for the container, this is what the container has
+// written to its console since it started, so it is the place to look if it doesn't boot.  Only the last
+// LOGREADLEN bytes are returned, truncated says if there was more
+func GetConsoleLog(host string, project string, name string) (string, bool, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return "", false, err
+	}
+
+	log, err := conn.GetInstanceConsoleLog(name, &lxd.InstanceConsoleLogArgs{})
+	if err != nil {
+		return "", false, err
+	}
+	defer log.Close()
+
+	return readTail(log, LOGREADLEN)
+}
+
+// GetLogFiles fetches every log file LXD has for the container, lxc.log, console.log, etc.
+func GetLogFiles(host string, project string, name string) ([]LogFile, error) {
+	var logFiles []LogFile
+
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return logFiles, err
+	}
+
+	files, err := conn.GetInstanceLogfiles(name)
+	if err != nil {
+		return logFiles, err
+	}
+
+	for _, file := range files {
+		log, err := conn.GetInstanceLogfile(name, file)
+		if err != nil {
+			return logFiles, err
+		}
+
+		contents, truncated, err := readTail(log, LOGREADLEN)
+		log.Close()
+		if err != nil {
+			return logFiles, err
+		}
+
+		logFiles = append(logFiles, LogFile{Name: file, Contents: contents, Truncated: truncated})
+	}
+
+	return logFiles, nil
+}
+
+// readTail reads everything from r but only keeps the last max bytes, the logs come to us as a stream so we can't
+// just seek to the end.  If we had to drop anything we also drop the partial line we would start with
+func readTail(r io.Reader, max int) (string, bool, error) {
+	var tail []byte
+	truncated := false
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		tail = append(tail, chunk[:n]...)
+		// only trim once we are well over so we aren't copying on every read
+		if len(tail) > 2*max {
+			tail = append([]byte(nil), tail[len(tail)-max:]...)
+			truncated = true
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", false, err
+		}
+	}
+
+	if len(tail) > max {
+		tail = tail[len(tail)-max:]
+		truncated = true
+	}
+	if truncated {
+		if idx := bytes.IndexByte(tail, '\n'); idx >= 0 {
+			tail = tail[idx+1:]
+		}
+	}
+
+	return string(tail), truncated, nil
+}
+
+// consoleTerminal is the read / write end the lxd client wants for a console.  We only follow the console,
+// so reads block until we are told to stop and writes go to our output
+type consoleTerminal struct {
+	output io.Writer
+	stop   <-chan struct{}
+}
+
+// Read never returns any input, just EOF once we are done
+func (c consoleTerminal) Read(b []byte) (int, error) {
+	<-c.stop
+	return 0, io.EOF
+}
+
+// Write passes console output along
+func (c consoleTerminal) Write(b []byte) (int, error) {
+	return c.output.Write(b)
+}
+
+// Close does nothing and is there just to satisfy the ReadWriteCloser interface
+func (c consoleTerminal) Close() error {
+	return nil
+}
+
+// FollowConsole attaches to the containers console and sends anything written to it to output until stop is
+// closed.  Nothing is ever sent to the console so this is safe for locked containers as well
+func FollowConsole(host string, project string, name string, output io.Writer, stop <-chan struct{}) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	disconnect := make(chan bool, 1)
+	args := lxd.InstanceConsoleArgs{
+		Terminal:          consoleTerminal{output: output, stop: stop},
+		ConsoleDisconnect: disconnect,
+	}
+
+	op, err := conn.ConsoleInstance(name, api.InstanceConsolePost{Width: 80, Height: 24}, &args)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-stop
+		disconnect <- true
+	}()
+
+	return op.Wait()
+}
@@ -0,0 +1,31 @@
+package lxd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadTail(t *testing.T) {
+	// Test 1, short enough to keep everything
+	tail, truncated, err := readTail(strings.NewReader("one\ntwo\n"), 100)
+	if err != nil || truncated || tail != "one\ntwo\n" {
+		t.Errorf("T1: Expected all of it untruncated got %q %v %v", tail, truncated, err)
+	}
+
+	// Test 2, we keep the end and drop the partial line we would start with
+	tail, truncated, err = readTail(strings.NewReader("first line\nsecond\nthird\n"), 10)
+	if err != nil || !truncated || tail != "third\n" {
+		t.Errorf("T2: Expected the last whole line truncated got %q %v %v", tail, truncated, err)
+	}
+
+	// Test 3, much bigger than what we keep so we trim while reading
+	var big strings.Builder
+	for i := 0; i < 100000; i++ {
+		big.WriteString("line\n")
+	}
+	big.WriteString("last\n")
+	tail, truncated, err = readTail(strings.NewReader(big.String()), 1000)
+	if err != nil || !truncated || len(tail) > 1000 || !strings.HasSuffix(tail, "line\nlast\n") || !strings.HasPrefix(tail, "line\n") {
+		t.Errorf("T3: Expected the end in whole lines truncated got %v bytes %v %v", len(tail), truncated, err)
+	}
+}
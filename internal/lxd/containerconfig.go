@@ -0,0 +1,369 @@
+package lxd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// ErrConfigConflict is returned when a container was changed by someone else between loading its config and saving it
+var ErrConfigConflict = errors.New("container was changed since its config was loaded")
+
+// ContainerConfig is the part of a container we allow editing after creation, its local config keys and devices.
+// Anything that comes from profiles is not included, and volatile keys are left for LXD to manage
+type ContainerConfig struct {
+	Config  map[string]string            `yaml:"config"`
+	Devices map[string]map[string]string `yaml:"devices"`
+}
+
+// ConfigChange is a single key that differs between two configs.  An empty Old means the key is being added, an empty
+// New means it is being removed
+type ConfigChange struct {
+	Key    string // config key, or device.key for devices
+	Device bool   // true if this is a device change
+	Old    string // current value
+	New    string // value after the change
+}
+
+// patterns for the values our known keys take
+var (
+	cpuSetRegex     = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+	cpuAllowRegex   = regexp.MustCompile(`^(\d{1,3}%|\d+ms/\d+ms)$`)
+	byteSizeRegex   = regexp.MustCompile(`^\d+(\.\d+)?\s*([kKMGTPE]i?)?B?$`)
+	percentageRegex = regexp.MustCompile(`^\d{1,3}%$`)
+)
+
+// knownConfigKeys are the config keys we know how to check, anything not in here (or matching knownConfigPrefixes)
+// is rejected so a typo doesn't get silently ignored
+var knownConfigKeys = map[string]func(string) error{
+	"boot.autostart":               validateBool,
+	"boot.autostart.delay":         validateInt(0, -1),
+	"boot.autostart.priority":      validateInt(0, -1),
+	"boot.host_shutdown_timeout":   validateInt(0, -1),
+	"boot.stop.priority":           validateInt(0, -1),
+	"limits.cpu":                   validateCPU,
+	"limits.cpu.allowance":         validateCPUAllowance,
+	"limits.cpu.priority":          validateInt(0, 10),
+	"limits.disk.priority":         validateInt(0, 10),
+	"limits.memory":                validateMemory,
+	"limits.memory.enforce":        validateOneOf("hard", "soft"),
+	"limits.memory.swap":           validateBool,
+	"limits.memory.swap.priority":  validateInt(0, 10),
+	"limits.network.priority":      validateInt(0, 10),
+	"limits.processes":             validateInt(1, -1),
+	"linux.kernel_modules":         validateAny,
+	"migration.incremental.memory": validateBool,
+	"migration.stateful":           validateBool,
+	"raw.apparmor":                 validateAny,
+	"raw.idmap":                    validateAny,
+	"raw.lxc":                      validateAny,
+	"raw.seccomp":                  validateAny,
+	"security.devlxd":              validateBool,
+	"security.idmap.isolated":      validateBool,
+	"security.nesting":             validateBool,
+	"security.privileged":          validateBool,
+	"security.protection.delete":   validateBool,
+	"security.protection.shift":    validateBool,
+	"snapshots.expiry":             validateAny,
+	"snapshots.pattern":            validateAny,
+	"snapshots.schedule":           validateAny,
+	"snapshots.schedule.stopped":   validateBool,
+}
+
+// knownConfigPrefixes are free form namespaces, the values are up to whoever uses them
+var knownConfigPrefixes = []string{"user.", "environment.", "image.", "limits.kernel.", "linux.sysctl.", "security.syscalls."}
+
+// knownDeviceTypes are the device types LXD supports for containers
+var knownDeviceTypes = []string{"none", "nic", "disk", "unix-char", "unix-block", "unix-hotplug", "usb", "gpu", "infiniband", "proxy", "tpm"}
+
+// GetContainerConfig returns the editable config of a container, along with the ETag to pass back to
+// UpdateContainerConfig so we can tell if it changed in the meantime
+func GetContainerConfig(host string, project string, name string) (*ContainerConfig, string, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return nil, "", err
+	}
+
+	container, etag, err := conn.GetInstance(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return editableConfig(container), etag, nil
+}
+
+// editableConfig copies the parts of a container we allow editing out of it
+func editableConfig(container *api.Instance) *ContainerConfig {
+	cfg := &ContainerConfig{
+		Config:  make(map[string]string),
+		Devices: make(map[string]map[string]string),
+	}
+	for k, v := range container.Config {
+		if !strings.HasPrefix(k, "volatile.") {
+			cfg.Config[k] = v
+		}
+	}
+	for name, device := range container.Devices {
+		cfg.Devices[name] = make(map[string]string)
+		for k, v := range device {
+			cfg.Devices[name][k] = v
+		}
+	}
+
+	return cfg
+}
+
+// UpdateContainerConfig replaces the config keys and devices of a container with the ones given, keeping any volatile
+// keys LXD has set.  If etag is not blank and the container has been changed since that etag, ErrConfigConflict
+// is returned and nothing is changed
+func UpdateContainerConfig(host string, project string, name string, cfg *ContainerConfig, etag string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	container, currentEtag, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+	if etag != "" && etag != currentEtag {
+		return ErrConfigConflict
+	}
+
+	err = ValidateContainerConfig(editableConfig(container), cfg)
+	if err != nil {
+		return err
+	}
+
+	put := container.Writable()
+	put.Config = make(map[string]string)
+	for k, v := range container.Config {
+		if strings.HasPrefix(k, "volatile.") {
+			put.Config[k] = v
+		}
+	}
+	for k, v := range cfg.Config {
+		put.Config[k] = v
+	}
+	put.Devices = cfg.Devices
+
+	// LXD will also check the etag, in case something changed between our read and write
+	return updateContainer(conn, name, put, currentEtag)
+}
+
+// updateContainer saves a container as long as its etag still matches, returning ErrConfigConflict if it doesn't
+func updateContainer(conn lxd.InstanceServer, name string, put api.InstancePut, etag string) error {
+	op, err := conn.UpdateInstance(name, put, etag)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusPreconditionFailed) {
+			return ErrConfigConflict
+		}
+		return err
+	}
+
+	// Like everything else this happens in the background, wait for it to finish
+	return op.Wait()
+}
+
+// ValidateContainerConfig checks every config key added or changed from current is one we know about with a sane
+// value, and that every added or changed device has a known type.  LXD knows about more keys than we do, so anything
+// already on the container is passed through as is, otherwise a container with one of those could never be edited.
+// A nil current means everything is new.  All the problems found are returned together so the user can fix them in
+// one go
+func ValidateContainerConfig(current *ContainerConfig, cfg *ContainerConfig) error {
+	if current == nil {
+		current = &ContainerConfig{}
+	}
+
+	var problems []string
+
+	keys := make([]string, 0, len(cfg.Config))
+	for k, v := range cfg.Config {
+		if cv, ok := current.Config[k]; !ok || cv != v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := validateConfigKey(k, cfg.Config[k])
+		if err != nil {
+			problems = append(problems, k+": "+err.Error())
+		}
+	}
+
+	devices := make([]string, 0, len(cfg.Devices))
+	for name, device := range cfg.Devices {
+		if !sameDevice(current.Devices[name], device) {
+			devices = append(devices, name)
+		}
+	}
+	sort.Strings(devices)
+
+	for _, name := range devices {
+		err := validateOneOf(knownDeviceTypes...)(cfg.Devices[name]["type"])
+		if err != nil {
+			problems = append(problems, "device "+name+" type: "+err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// sameDevice is whether two device configs have exactly the same keys and values
+func sameDevice(a map[string]string, b map[string]string) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DiffContainerConfig returns every config key and device key that differs between the two configs, config keys
+// first then devices, each sorted by key
+func DiffContainerConfig(current *ContainerConfig, updated *ContainerConfig) []ConfigChange {
+	changes := diffMaps(current.Config, updated.Config, false)
+	return append(changes, diffMaps(flattenDevices(current.Devices), flattenDevices(updated.Devices), true)...)
+}
+
+// flattenDevices turns our device map into device.key -> value so it can be diffed like the config
+func flattenDevices(devices map[string]map[string]string) map[string]string {
+	flat := make(map[string]string)
+	for name, device := range devices {
+		for k, v := range device {
+			flat[name+"."+k] = v
+		}
+	}
+	return flat
+}
+
+// diffMaps returns the sorted list of keys that were added, removed, or changed between current and updated
+func diffMaps(current map[string]string, updated map[string]string, device bool) []ConfigChange {
+	var changes []ConfigChange
+
+	for k, v := range current {
+		if nv, ok := updated[k]; !ok || nv != v {
+			changes = append(changes, ConfigChange{Key: k, Device: device, Old: v, New: updated[k]})
+		}
+	}
+	for k, v := range updated {
+		if _, ok := current[k]; !ok {
+			changes = append(changes, ConfigChange{Key: k, Device: device, New: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// validateConfigKey looks up the validator for a key, or checks it against our free form prefixes
+func validateConfigKey(key string, value string) error {
+	if strings.HasPrefix(key, "volatile.") {
+		return errors.New("volatile keys are managed by LXD")
+	}
+
+	if validate, ok := knownConfigKeys[key]; ok {
+		// a blank value just unsets the key
+		if value == "" {
+			return nil
+		}
+		return validate(value)
+	}
+
+	for _, prefix := range knownConfigPrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return nil
+		}
+	}
+
+	return errors.New("unknown config key")
+}
+
+func validateAny(value string) error {
+	return nil
+}
+
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+// validateInt returns a validator for an integer in the range min to max, a max of -1 means no upper bound
+func validateInt(min int, max int) func(string) error {
+	return func(value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		if i < min || (max >= 0 && i > max) {
+			if max < 0 {
+				return fmt.Errorf("must be at least %v", min)
+			}
+			return fmt.Errorf("must be between %v and %v", min, max)
+		}
+		return nil
+	}
+}
+
+// validateOneOf returns a validator that only accepts the values given
+func validateOneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return errors.New("must be one of " + strings.Join(values, ", "))
+	}
+}
+
+// validateCPU accepts a number of CPUs, or a set of CPUs to pin to like 0-1,4
+func validateCPU(value string) error {
+	if !cpuSetRegex.MatchString(value) || value == "0" {
+		return errors.New("must be a number of CPUs or a CPU set like 0-1,4")
+	}
+	return nil
+}
+
+// validateCPUAllowance accepts a percentage or a time slice like 25ms/100ms
+func validateCPUAllowance(value string) error {
+	if !cpuAllowRegex.MatchString(value) {
+		return errors.New("must be a percentage or a time slice like 25ms/100ms")
+	}
+	return nil
+}
+
+// validateMemory accepts a size like 512MB or 2GiB, or a percentage of the host memory
+func validateMemory(value string) error {
+	if !byteSizeRegex.MatchString(value) && !percentageRegex.MatchString(value) {
+		return errors.New("must be a size like 512MB or 2GiB, or a percentage")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lxd
+
+import (
+	"testing"
+)
+
+func TestValidateContainerConfig(t *testing.T) {
+	// Test 1, known keys with good values and free form namespaces pass
+	cfg := &ContainerConfig{
+		Config: map[string]string{
+			"limits.cpu":          "0-1,4",
+			"limits.memory":       "2GiB",
+			"limits.memory.swap":  "false",
+			"limits.cpu.priority": "",
+			"user.owner":          "alice",
+		},
+		Devices: map[string]map[string]string{
+			"eth0": {"type": "nic", "network": "lxdbr0"},
+		},
+	}
+	if err := ValidateContainerConfig(nil, cfg); err != nil {
+		t.Errorf("T1: Expected no error got %v", err)
+	}
+
+	// Test 2, bad values, unknown keys, volatile keys, and unknown device types all fail
+	bad := map[string]string{
+		"limits.memory":        "lots",
+		"limits.cpu.priority":  "11",
+		"limits.cpus":          "2",
+		"volatile.eth0.hwaddr": "00:16:3e:00:00:00",
+		"user.":                "nothing",
+	}
+	for k, v := range bad {
+		cfg = &ContainerConfig{Config: map[string]string{k: v}}
+		if err := ValidateContainerConfig(nil, cfg); err == nil {
+			t.Errorf("T2: Expected an error for %v=%v", k, v)
+		}
+	}
+
+	cfg = &ContainerConfig{Devices: map[string]map[string]string{"eth0": {"nictype": "bridged"}}}
+	if err := ValidateContainerConfig(nil, cfg); err == nil {
+		t.Errorf("T2: Expected an error for a device with no type")
+	}
+
+	// Test 3, keys and devices we don't know that are already on the container pass through, but not changed ones
+	current := &ContainerConfig{
+		Config:  map[string]string{"security.secureboot": "false", "cloud-init.user-data": "#cloud-config"},
+		Devices: map[string]map[string]string{"odd": {"type": "something-new"}},
+	}
+	cfg = &ContainerConfig{
+		Config:  map[string]string{"security.secureboot": "false", "cloud-init.user-data": "#cloud-config", "limits.cpu": "2"},
+		Devices: map[string]map[string]string{"odd": {"type": "something-new"}},
+	}
+	if err := ValidateContainerConfig(current, cfg); err != nil {
+		t.Errorf("T3: Expected no error got %v", err)
+	}
+	cfg.Config["security.secureboot"] = "true"
+	if err := ValidateContainerConfig(current, cfg); err == nil {
+		t.Errorf("T3: Expected an error for a changed unknown key")
+	}
+}
+
+func TestDiffContainerConfig(t *testing.T) {
+	current := &ContainerConfig{
+		Config:  map[string]string{"limits.cpu": "1", "limits.memory": "1GB", "user.owner": "alice"},
+		Devices: map[string]map[string]string{"eth0": {"type": "nic", "network": "lxdbr0"}},
+	}
+	updated := &ContainerConfig{
+		Config:  map[string]string{"limits.cpu": "2", "user.owner": "alice", "boot.autostart": "true"},
+		Devices: map[string]map[string]string{"eth0": {"type": "nic", "network": "lxdbr1"}},
+	}
+
+	expected := []ConfigChange{
+		{Key: "boot.autostart", New: "true"},
+		{Key: "limits.cpu", Old: "1", New: "2"},
+		{Key: "limits.memory", Old: "1GB"},
+		{Key: "eth0.network", Device: true, Old: "lxdbr0", New: "lxdbr1"},
+	}
+
+	changes := DiffContainerConfig(current, updated)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %v got %v", expected[i], changes[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package lxd
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DeviceInfo is a device attached to a container, either directly or through one of its profiles
+type DeviceInfo struct {
+	Name    string            // device name, eth0, root, etc.
+	Type    string            // nic, disk, proxy, etc.
+	Options map[string]string // everything else set on the device
+	Profile bool              // true if the device comes from a profile, which we can't remove from here
+}
+
+// device names end up in paths and interface names so keep them simple
+var deviceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// proxy addresses look like tcp:127.0.0.1:80 or unix:/some/socket
+var proxyAddrRegex = regexp.MustCompile(`^(tcp|udp):.+:[0-9-,]+$|^unix:.+$`)
+
+// GetDevices returns all the devices on a container, including ones inherited from profiles, sorted by name
+func GetDevices(host string, project string, name string) ([]DeviceInfo, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return nil, err
+	}
+
+	container, _, err := conn.GetInstance(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []DeviceInfo
+	for dname, device := range container.ExpandedDevices {
+		info := DeviceInfo{
+			Name:    dname,
+			Type:    device["type"],
+			Options: make(map[string]string),
+		}
+		for k, v := range device {
+			if k != "type" {
+				info.Options[k] = v
+			}
+		}
+		// if the container doesn't have it directly it came from a profile
+		if _, ok := container.Devices[dname]; !ok {
+			info.Profile = true
+		}
+		devices = append(devices, info)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+
+	return devices, nil
+}
+
+// AddDevice adds a nic, disk or proxy device to a container.  options is the full device config including its type.
+// A device from a profile with the same name will be overridden by this one, like LXD normally does
+func AddDevice(host string, project string, name string, device string, options map[string]string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	if !deviceNameRegex.MatchString(device) {
+		return errors.New("invalid device name")
+	}
+
+	err = validateDevice(options)
+	if err != nil {
+		return err
+	}
+
+	container, etag, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := container.Devices[device]; ok {
+		return errors.New("device " + device + " already exists")
+	}
+
+	put := container.Writable()
+	if put.Devices == nil {
+		put.Devices = make(map[string]map[string]string)
+	}
+	put.Devices[device] = options
+
+	return updateContainer(conn, name, put, etag)
+}
+
+// RemoveDevice removes a device set directly on the container.  Devices from profiles have to be removed from the
+// profile, and we won't remove the root disk
+func RemoveDevice(host string, project string, name string, device string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	container, etag, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+
+	options, ok := container.Devices[device]
+	if !ok {
+		if _, ok := container.ExpandedDevices[device]; ok {
+			return errors.New("device " + device + " comes from a profile")
+		}
+		return errors.New("device " + device + " does not exist")
+	}
+	if options["type"] == "disk" && options["path"] == "/" {
+		return errors.New("refusing to remove the root disk")
+	}
+
+	put := container.Writable()
+	delete(put.Devices, device)
+
+	return updateContainer(conn, name, put, etag)
+}
+
+// validateDevice makes sure a device we are adding has the options it needs for its type
+func validateDevice(options map[string]string) error {
+	switch options["type"] {
+	case "nic":
+		if options["network"] == "" && options["parent"] == "" {
+			return errors.New("nic devices need a network or a parent interface")
+		}
+	case "disk":
+		if !strings.HasPrefix(options["path"], "/") {
+			return errors.New("disk devices need an absolute path to mount at")
+		}
+		if options["source"] == "" {
+			return errors.New("disk devices need a source, a host path or a custom volume name")
+		}
+		// without a pool the source is a path on the host
+		if options["pool"] == "" && !strings.HasPrefix(options["source"], "/") {
+			return errors.New("disk source must be an absolute host path, or a volume name with a pool")
+		}
+	case "proxy":
+		if !proxyAddrRegex.MatchString(options["listen"]) || !proxyAddrRegex.MatchString(options["connect"]) {
+			return errors.New("proxy devices need listen and connect addresses like tcp:0.0.0.0:80")
+		}
+	default:
+		return errors.New("only nic, disk and proxy devices can be added")
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package lxd
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// ContainerEvent is a lifecycle change to a container that we heard about from a hosts event stream
+type ContainerEvent struct {
+	Host    string // host the event came from
+	Project string // LXD project the container is in
+	Name    string // container name
+	Action  string // created, started, stopped or deleted
+}
+
+// eventActions maps the LXD lifecycle actions we care about to what we tell the UI, restarts and shutdowns end
+// up in the same place as a start or stop so there is no reason to treat them differently
+var eventActions = map[string]string{
+	"instance-created":   "created",
+	"instance-started":   "started",
+	"instance-restarted": "started",
+	"instance-stopped":   "stopped",
+	"instance-shutdown":  "stopped",
+	"instance-deleted":   "deleted",
+}
+
+// eventRetryDelay is how long we wait to reconnect to an event stream that dropped, or we couldn't connect to
+const eventRetryDelay = 10 * time.Second
+
+// WatchEvents listens to the event stream of every project on every host in the background, calling handler for
+// each container lifecycle change.  Streams that drop are reconnected, so this runs until the main process exits
+func WatchEvents(handler func(ContainerEvent)) {
+	for _, lxdh := range Conf.LXDhosts {
+		for _, p := range lxdh.Projects {
+			go watchProjectEvents(lxdh.Host, p, handler)
+		}
+	}
+}
+
+// watchProjectEvents listens to the events for a single project on a host, reconnecting whenever we lose it
+func watchProjectEvents(host string, project string, handler func(ContainerEvent)) {
+	for {
+		conn, err := getConnection(host, project)
+		if err != nil {
+			log.Printf("Connection error to " + host + " : " + err.Error())
+			time.Sleep(eventRetryDelay)
+			continue
+		}
+
+		listener, err := conn.GetEvents()
+		if err != nil {
+			log.Printf("Could not get events from " + host + " : " + err.Error())
+			expireConnection(host)
+			time.Sleep(eventRetryDelay)
+			continue
+		}
+
+		_, err = listener.AddHandler([]string{"lifecycle"}, func(e api.Event) {
+			event, ok := parseLifecycleEvent(host, project, e)
+			if ok {
+				// update the inventory first, so anyone reloading a page because of the event sees the change
+				refreshInventoryContainer(event.Host, event.Project, event.Name)
+				handler(event)
+			}
+		})
+		if err != nil {
+			log.Printf("Could not watch events from " + host + " : " + err.Error())
+			listener.Disconnect()
+			time.Sleep(eventRetryDelay)
+			continue
+		}
+
+		// Wait blocks until the stream goes away, usually because the host restarted, then we start over
+		err = listener.Wait()
+		if err != nil {
+			log.Printf("Lost events from " + host + " : " + err.Error())
+		}
+		expireConnection(host)
+		time.Sleep(eventRetryDelay)
+	}
+}
+
+// parseLifecycleEvent pulls the container and what happened to it out of a lifecycle event.  ok is false for
+// events about anything other than a container, or actions we don't pass along
+func parseLifecycleEvent(host string, project string, e api.Event) (ContainerEvent, bool) {
+	var lifecycle api.EventLifecycle
+	err := json.Unmarshal(e.Metadata, &lifecycle)
+	if err != nil {
+		return ContainerEvent{}, false
+	}
+
+	action, ok := eventActions[lifecycle.Action]
+	if !ok {
+		return ContainerEvent{}, false
+	}
+
+	// the source is the API url of the container, like /1.0/instances/NAME?project=PROJECT
+	source, err := url.Parse(lifecycle.Source)
+	if err != nil || !strings.HasPrefix(source.Path, "/1.0/instances/") {
+		return ContainerEvent{}, false
+	}
+	name := strings.TrimPrefix(source.Path, "/1.0/instances/")
+	// snapshots and the like have more after the name
+	if name == "" || strings.Contains(name, "/") {
+		return ContainerEvent{}, false
+	}
+
+	if e.Project != "" {
+		project = e.Project
+	}
+
+	return ContainerEvent{
+		Host:    host,
+		Project: project,
+		Name:    name,
+		Action:  action,
+	}, true
+}
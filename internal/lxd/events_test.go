@@ -0,0 +1,44 @@
+package lxd
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestParseLifecycleEvent(t *testing.T) {
+	// Test 1, a start in a non default project
+	e := api.Event{
+		Type:     "lifecycle",
+		Metadata: []byte(`{"action":"instance-started","source":"/1.0/instances/web1?project=dev"}`),
+		Project:  "dev",
+	}
+	event, ok := parseLifecycleEvent("host1", "dev", e)
+	if !ok {
+		t.Fatalf("T1: Expected an event")
+	}
+	if event.Host != "host1" || event.Project != "dev" || event.Name != "web1" || event.Action != "started" {
+		t.Errorf("T1: Unexpected event %+v", event)
+	}
+
+	// Test 2, shutdowns are just stops, and we fall back to the project we are listening to
+	e = api.Event{Type: "lifecycle", Metadata: []byte(`{"action":"instance-shutdown","source":"/1.0/instances/web1"}`)}
+	event, ok = parseLifecycleEvent("host1", "default", e)
+	if !ok || event.Action != "stopped" || event.Project != "default" {
+		t.Errorf("T2: Unexpected event %+v %v", event, ok)
+	}
+
+	// Test 3, snapshots, other objects, actions we skip and junk are all ignored
+	ignored := []string{
+		`{"action":"instance-snapshot-created","source":"/1.0/instances/web1/snapshots/snap0"}`,
+		`{"action":"instance-started","source":"/1.0/instances/web1/snapshots/snap0"}`,
+		`{"action":"image-created","source":"/1.0/images/abc"}`,
+		`{"action":"instance-updated","source":"/1.0/instances/web1"}`,
+		`not json`,
+	}
+	for _, m := range ignored {
+		if event, ok := parseLifecycleEvent("host1", "default", api.Event{Metadata: []byte(m)}); ok {
+			t.Errorf("T3: Expected %v to be ignored, got %+v", m, event)
+		}
+	}
+}
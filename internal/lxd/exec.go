@@ -0,0 +1,301 @@
+package lxd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// EXECHISTORYLEN is how many command results we keep per container
+const EXECHISTORYLEN = 25
+
+// EXECOUTPUTLEN is the most output we keep, per stream, for each command.  Anything past this is dropped
+// so a chatty command can't eat all our memory
+const EXECOUTPUTLEN = 256 * 1024
+
+// ExecResult is the outcome of a command we ran on a container, kept around so users can look at the
+// output after the fact
+type ExecResult struct {
+	Command     []string      // the command we ran
+	StartedAt   time.Time     // when we started it
+	Duration    time.Duration // how long it took
+	ReturnValue float64       // return value of the command, -1 if something outside the command went wrong
+	Stdout      string        // captured stdout, possibly truncated
+	Stderr      string        // captured stderr, possibly truncated
+	Error       string        // any error running the command, blank if it ran
+}
+
+// host:project:name -> results, newest last
+var execHistory = make(map[string][]ExecResult)
+
+// mutex for our exec history
+var execMutex = &sync.RWMutex{}
+
+// writeCloser turns any Writer into the WriteCloser the lxd client wants for stdout / stderr
+type writeCloser struct {
+	io.Writer
+}
+
+// Close does nothing and is there just to satisfy the WriteCloser interface
+func (writeCloser) Close() error {
+	return nil
+}
+
+// limitedBuffer is a bytes.Buffer that quietly stops storing data once it hits its limit
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write stores what it can and always reports success so the command output keeps flowing
+func (l *limitedBuffer) Write(b []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); room < len(b) {
+		l.truncated = true
+		if room > 0 {
+			l.buf.Write(b[:room])
+		}
+		return len(b), nil
+	}
+
+	return l.buf.Write(b)
+}
+
+// String returns what we stored, noting if anything was dropped
+func (l *limitedBuffer) String() string {
+	if l.truncated {
+		return l.buf.String() + "\n... output truncated"
+	}
+	return l.buf.String()
+}
+
+// ExecCommand runs a command on the container.  Output is sent to stdout and stderr as it arrives if they are
+// not nil, and also captured and saved in the containers exec history, see GetExecHistory.  -1 is our return if
+// something outside the command went wrong
+func ExecCommand(host string, project string, name string, command []string, stdout io.Writer, stderr io.Writer) (float64, error) {
+	result := ExecResult{
+		Command:     command,
+		StartedAt:   time.Now(),
+		ReturnValue: -1,
+	}
+
+	outBuf := &limitedBuffer{limit: EXECOUTPUTLEN}
+	errBuf := &limitedBuffer{limit: EXECOUTPUTLEN}
+
+	rv, err := execCommand(host, project, name, command, tee(outBuf, stdout), tee(errBuf, stderr))
+
+	result.Duration = time.Since(result.StartedAt)
+	result.ReturnValue = rv
+	result.Stdout = outBuf.String()
+	result.Stderr = errBuf.String()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	addExecHistory(host, project, name, result)
+
+	return rv, err
+}
+
+// WaitForAgent waits up to timeout for the lxd-agent in a virtual machine to answer, which it has to before we can
+// run commands or push files.  Containers don't need an agent so for them this returns right away
+func WaitForAgent(host string, project string, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := execCommand(host, project, name, []string{"true"}, writeCloser{io.Discard}, writeCloser{io.Discard})
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for lxd-agent: " + err.Error())
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// GetExecHistory returns the results of the commands we have run on a container, newest first.  History only
+// lives in memory so it is lost on restart
+func GetExecHistory(host string, project string, name string) []ExecResult {
+	execMutex.RLock()
+	defer execMutex.RUnlock()
+
+	history := execHistory[host+":"+project+":"+name]
+	results := make([]ExecResult, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		results = append(results, history[i])
+	}
+
+	return results
+}
+
+// addExecHistory saves a result, dropping the oldest once we hit EXECHISTORYLEN
+func addExecHistory(host string, project string, name string, result ExecResult) {
+	execMutex.Lock()
+	defer execMutex.Unlock()
+
+	key := host + ":" + project + ":" + name
+	history := append(execHistory[key], result)
+	if len(history) > EXECHISTORYLEN {
+		history = history[len(history)-EXECHISTORYLEN:]
+	}
+	execHistory[key] = history
+}
+
+// tee sends writes to our capture buffer and the callers writer if they gave us one
+func tee(capture io.Writer, w io.Writer) io.WriteCloser {
+	if w == nil {
+		return writeCloser{capture}
+	}
+	return writeCloser{io.MultiWriter(capture, w)}
+}
+
+// execCommand does the actual work for ExecCommand
+func execCommand(host string, project string, name string, command []string, stdout io.WriteCloser, stderr io.WriteCloser) (float64, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return -1, err
+	}
+
+	cmd := api.InstanceExecPost{
+		Command:     command,
+		WaitForWS:   true,
+		Interactive: false,
+	}
+
+	// Nothing we run should need input, so give it an empty stdin which it will see as EOF.  DataDone lets
+	// us know when all the output has been received, as that can trail the command finishing
+	dataDone := make(chan bool)
+	args := lxd.InstanceExecArgs{
+		Stdin:    io.NopCloser(bytes.NewReader(nil)),
+		Stdout:   stdout,
+		Stderr:   stderr,
+		DataDone: dataDone,
+	}
+
+	// schedule the command to execute
+	op, err := conn.ExecInstance(name, cmd, &args)
+	if err != nil {
+		return -1, err
+	}
+
+	// wait for the command to finish
+	err = op.Wait()
+	if err != nil {
+		return -1, err
+	}
+
+	// and then for the rest of the output, but don't hang forever if the websockets never finish
+	select {
+	case <-dataDone:
+	case <-time.After(10 * time.Second):
+	}
+
+	// Get the status of the command and convert the return value to a number
+	status := op.Get()
+	statuscode, ok := status.Metadata["return"].(float64)
+	if !ok {
+		return -1, errors.New("failed to parse return value")
+	}
+
+	return statuscode, nil
+}
+
+// TerminalSize is the size of a terminal window in characters
+type TerminalSize struct {
+	Width  int `json:"cols"`
+	Height int `json:"rows"`
+}
+
+// ExecTerminal runs an interactive command, like a shell, on the container with a PTY.  Input is read from
+// stdin and all output goes to stdout.  Any sizes sent on resize are passed along to the PTY, and closing
+// hangup sends SIGHUP to the command so it knows the user went away.  Like other management actions
+// this is not allowed if the container is locked
+func ExecTerminal(host string, project string, name string, command []string, stdin io.ReadCloser, stdout io.WriteCloser, size TerminalSize, resize <-chan TerminalSize, hangup <-chan struct{}) (float64, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return -1, err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return -1, err
+	}
+
+	cmd := api.InstanceExecPost{
+		Command:     command,
+		WaitForWS:   true,
+		Interactive: true,
+		Width:       size.Width,
+		Height:      size.Height,
+		Environment: map[string]string{
+			"TERM": "xterm-256color",
+		},
+	}
+
+	// the control websocket is how we tell LXD about window changes and send signals, we keep it running
+	// until the command finishes
+	finished := make(chan struct{})
+	control := func(control *websocket.Conn) {
+		for {
+			select {
+			case s := <-resize:
+				msg := api.InstanceExecControl{
+					Command: "window-resize",
+					Args: map[string]string{
+						"width":  strconv.Itoa(s.Width),
+						"height": strconv.Itoa(s.Height),
+					},
+				}
+				err := control.WriteJSON(msg)
+				if err != nil {
+					return
+				}
+			case <-hangup:
+				// 1 is SIGHUP, the same thing a real terminal would send when it goes away
+				control.WriteJSON(api.InstanceExecControl{Command: "signal", Signal: 1})
+				return
+			case <-finished:
+				return
+			}
+		}
+	}
+
+	dataDone := make(chan bool)
+	args := lxd.InstanceExecArgs{
+		Stdin:    stdin,
+		Stdout:   stdout,
+		Stderr:   stdout,
+		Control:  control,
+		DataDone: dataDone,
+	}
+
+	op, err := conn.ExecInstance(name, cmd, &args)
+	if err != nil {
+		return -1, err
+	}
+
+	err = op.Wait()
+	close(finished)
+	if err != nil {
+		return -1, err
+	}
+
+	select {
+	case <-dataDone:
+	case <-time.After(10 * time.Second):
+	}
+
+	status := op.Get()
+	statuscode, ok := status.Metadata["return"].(float64)
+	if !ok {
+		return -1, errors.New("failed to parse return value")
+	}
+
+	return statuscode, nil
+}
@@ -0,0 +1,99 @@
+package lxd
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	lxd "github.com/lxc/lxd/client"
+)
+
+// FileInfo describes a file or directory on a container
+type FileInfo struct {
+	Path    string   // full path on the container
+	Type    string   // file, directory or symlink
+	Mode    int      // permissions
+	UID     int64    // owner
+	GID     int64    // group
+	Entries []string // for directories, the sorted names of everything in it
+}
+
+// GetFile fetches a path from the container.  For a file the contents are returned as a stream which the caller
+// must close, for a directory the contents will be nil and FileInfo.Entries will list what is in it
+func GetFile(host string, project string, name string, path string) (io.ReadCloser, *FileInfo, error) {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, resp, err := conn.GetInstanceFile(name, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &FileInfo{
+		Path:    path,
+		Type:    resp.Type,
+		Mode:    resp.Mode,
+		UID:     resp.UID,
+		GID:     resp.GID,
+		Entries: resp.Entries,
+	}
+	sort.Strings(info.Entries)
+
+	if info.Type == "directory" && content != nil {
+		content.Close()
+		content = nil
+	}
+
+	return content, info, nil
+}
+
+// PushFile streams content to a file on the container, creating or replacing it.  The lxd client wants something
+// it can seek, so callers with large uploads should hand us a file rather than buffering in memory
+func PushFile(host string, project string, name string, path string, mode int, content io.ReadSeeker) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	args := lxd.InstanceFileArgs{
+		Content:   content,
+		Mode:      mode,
+		Type:      "file",
+		WriteMode: "overwrite",
+	}
+
+	return conn.CreateInstanceFile(name, path, args)
+}
+
+// MakeDirectory creates a directory on the container
+func MakeDirectory(host string, project string, name string, path string, mode int) error {
+	err := checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	// CreateFile already knows how to make directories if the path ends in /
+	return CreateFile(host, project, name, strings.TrimSuffix(path, "/")+"/", mode, "")
+}
+
+// DeletePath removes a file or an empty directory from the container
+func DeletePath(host string, project string, name string, path string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	return conn.DeleteInstanceFile(name, path)
+}
@@ -0,0 +1,127 @@
+package lxd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+// HostHealth is what we last saw when checking in on a host
+type HostHealth struct {
+	Host       *config.LXDhost // Host details
+	Online     bool            // whether the host answered the last check
+	Latency    time.Duration   // how long the last check took, including connecting if we had to
+	Version    string          // LXD version the host is running
+	LastError  string          // error from the last check, blank if it was fine
+	CheckedAt  time.Time       // when we last checked, zero if we haven't yet
+	LastOnline time.Time       // when the host last answered, zero if it never has
+}
+
+// healthCheckInterval is how often we check on every host
+const healthCheckInterval = 30 * time.Second
+
+// healthCheckTimeout is how long a host has to answer before we call it offline
+const healthCheckTimeout = 10 * time.Second
+
+// host -> last health check
+var hostHealth = make(map[string]*HostHealth)
+
+// mutex for our health map
+var healthMutex = &sync.RWMutex{}
+
+// StartHealthChecks starts a background goroutine checking on every host every healthCheckInterval, the first
+// check happens right away so we know what is offline as soon as possible
+func StartHealthChecks() {
+	ticker := time.NewTicker(healthCheckInterval)
+	// normally we would have a channel to indicate we are done, but this will run until the main process exits
+	go func() {
+		checkHosts()
+		for range ticker.C {
+			checkHosts()
+		}
+	}()
+}
+
+// GetHostHealth returns the last health check for each host, hosts we haven't checked yet are neither online nor
+// have a CheckedAt time
+func GetHostHealth() map[string]HostHealth {
+	health := make(map[string]HostHealth)
+
+	healthMutex.RLock()
+	defer healthMutex.RUnlock()
+
+	for _, lxdh := range Conf.LXDhosts {
+		if h, ok := hostHealth[lxdh.Host]; ok {
+			health[lxdh.Host] = *h
+		} else {
+			health[lxdh.Host] = HostHealth{Host: lxdh}
+		}
+	}
+
+	return health
+}
+
+// checkHosts checks every host at the same time, so one slow host doesn't hold up knowing about the rest
+func checkHosts() {
+	var wg sync.WaitGroup
+	for _, lxdh := range Conf.LXDhosts {
+		wg.Add(1)
+		go func(lxdh *config.LXDhost) {
+			defer wg.Done()
+			checkHost(lxdh)
+		}(lxdh)
+	}
+	wg.Wait()
+}
+
+// checkHost asks a host about itself and records how that went
+func checkHost(lxdh *config.LXDhost) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	version, err := callWithContext(ctx, func() (string, error) {
+		conn, err := getConnection(lxdh.Host, "")
+		if err != nil {
+			return "", err
+		}
+		server, _, err := conn.GetServer()
+		if err != nil {
+			return "", err
+		}
+		return server.Environment.ServerVersion, nil
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("no answer after " + healthCheckTimeout.String())
+	}
+
+	// make sure whoever uses the connection next checks it, instead of trusting it for a while longer
+	if err != nil {
+		expireConnection(lxdh.Host)
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	h, ok := hostHealth[lxdh.Host]
+	if !ok {
+		h = &HostHealth{Host: lxdh}
+		hostHealth[lxdh.Host] = h
+	}
+
+	h.CheckedAt = time.Now()
+	h.Latency = h.CheckedAt.Sub(start)
+	if err != nil {
+		h.Online = false
+		h.LastError = err.Error()
+		return
+	}
+
+	h.Online = true
+	h.Version = version
+	h.LastError = ""
+	h.LastOnline = h.CheckedAt
+}
@@ -0,0 +1,334 @@
+package lxd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/ioprogress"
+)
+
+// ImportImage copies an image from a public image server, like https://images.linuxcontainers.org, to one of our hosts.
+// protocol is either simplestreams or lxd, image is an alias or fingerprint on that server.  If alias is set the new
+// image gets that alias on our host.  progress is called with status updates as the download happens
+func ImportImage(host string, server string, protocol string, image string, alias string, progress func(string)) error {
+	// whatever happens here, even a failure, the inventory should take another look at the images
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	remote, err := connectImageServer(server, protocol)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := resolveImage(remote, image)
+	img, _, err := remote.GetImage(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	args := &lxd.ImageCopyArgs{}
+	if alias != "" {
+		args.Aliases = []api.ImageAlias{{Name: alias}}
+	}
+
+	log.Printf("importing image %v from %v to %v\n", image, server, host)
+	op, err := conn.CopyImage(remote, *img, args)
+	if err != nil {
+		return err
+	}
+
+	return waitForImageCopy(op, progress)
+}
+
+// GetRemoteImageFingerprint looks up the fingerprint of an image, by alias or fingerprint, on a public image server
+func GetRemoteImageFingerprint(server string, protocol string, image string) (string, error) {
+	remote, err := connectImageServer(server, protocol)
+	if err != nil {
+		return "", err
+	}
+
+	img, _, err := remote.GetImage(resolveImage(remote, image))
+	if err != nil {
+		return "", err
+	}
+
+	return img.Fingerprint, nil
+}
+
+// ImportImageFile creates an image on the host from an uploaded image tarball.  meta is either a unified tarball or
+// the metadata half of a split image, in which case rootfs is the other half, otherwise rootfs should be nil
+func ImportImageFile(host string, alias string, meta io.Reader, metaName string, rootfs io.Reader, rootfsName string, progress func(string)) error {
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	var req api.ImagesPost
+	if alias != "" {
+		req.Aliases = []api.ImageAlias{{Name: alias}}
+	}
+
+	args := &lxd.ImageCreateArgs{
+		MetaFile: meta,
+		MetaName: metaName,
+		ProgressHandler: func(p ioprogress.ProgressData) {
+			if progress != nil {
+				progress(p.Text)
+			}
+		},
+	}
+	if rootfs != nil {
+		args.RootfsFile = rootfs
+		args.RootfsName = rootfsName
+	}
+
+	log.Printf("importing image file %v to %v\n", metaName, host)
+	op, err := conn.CreateImage(req, args)
+	if err != nil {
+		return err
+	}
+
+	return op.Wait()
+}
+
+// CopyImage copies an image, and its aliases, from one of our hosts to another.  Aliases that already exist on the
+// destination are skipped so they keep pointing where they did
+func CopyImage(srcHost string, dstHost string, fingerprint string, progress func(string)) error {
+	defer expireInventoryImages()
+
+	if srcHost == dstHost {
+		return errors.New("source and destination hosts are the same")
+	}
+
+	srcconn, err := getConnection(srcHost, "")
+	if err != nil {
+		return err
+	}
+
+	dstconn, err := getConnection(dstHost, "")
+	if err != nil {
+		return err
+	}
+
+	img, _, err := srcconn.GetImage(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	existing, err := dstconn.GetImageAliasNames()
+	if err != nil {
+		return err
+	}
+
+	args := &lxd.ImageCopyArgs{}
+	for _, alias := range img.Aliases {
+		found := false
+		for _, name := range existing {
+			if name == alias.Name {
+				found = true
+			}
+		}
+		if !found {
+			args.Aliases = append(args.Aliases, alias)
+		}
+	}
+
+	log.Printf("copying image %v from %v to %v\n", fingerprint, srcHost, dstHost)
+	op, err := dstconn.CopyImage(srcconn, *img, args)
+	if err != nil {
+		return err
+	}
+
+	return waitForImageCopy(op, progress)
+}
+
+// DeleteImage removes an image from a host.  Containers already created from it are not affected
+func DeleteImage(host string, fingerprint string) error {
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.DeleteImage(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	return op.Wait()
+}
+
+// AddImageAlias points a new alias at an image
+func AddImageAlias(host string, fingerprint string, alias string) error {
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(alias) == "" {
+		return errors.New("alias can not be blank")
+	}
+
+	req := api.ImageAliasesPost{}
+	req.Name = alias
+	req.Target = fingerprint
+
+	return conn.CreateImageAlias(req)
+}
+
+// RemoveImageAlias removes an alias, the image itself is left alone
+func RemoveImageAlias(host string, alias string) error {
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	return conn.DeleteImageAlias(alias)
+}
+
+// ImageOrigin is where SyncImage can copy an image from, either another one of our hosts or a public image server
+type ImageOrigin struct {
+	Host     string // one of our hosts
+	Server   string // or an image server url
+	Protocol string // and its protocol, simplestreams or lxd
+}
+
+// GetImageAliasTarget returns the fingerprint an alias points to on a host, or blank if the alias doesn't exist
+func GetImageAliasTarget(host string, alias string) (string, error) {
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return "", err
+	}
+
+	entry, _, err := conn.GetImageAlias(alias)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return entry.Target, nil
+}
+
+// SyncImage makes sure a host has the image with the given fingerprint, copying it from origin if it doesn't, and
+// that alias points at it
+func SyncImage(host string, alias string, fingerprint string, origin ImageOrigin) error {
+	defer expireInventoryImages()
+
+	conn, err := getConnection(host, "")
+	if err != nil {
+		return err
+	}
+
+	_, _, err = conn.GetImage(fingerprint)
+	if err != nil {
+		if !api.StatusErrorCheck(err, http.StatusNotFound) {
+			return err
+		}
+
+		var source lxd.ImageServer
+		if origin.Host != "" {
+			source, err = getConnection(origin.Host, "")
+		} else {
+			source, err = connectImageServer(origin.Server, origin.Protocol)
+		}
+		if err != nil {
+			return err
+		}
+
+		img, _, err := source.GetImage(fingerprint)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("image sync copying %v (%v) to %v\n", alias, fingerprint, host)
+		op, err := conn.CopyImage(source, *img, &lxd.ImageCopyArgs{})
+		if err != nil {
+			return err
+		}
+		err = op.Wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	entry, etag, err := conn.GetImageAlias(alias)
+	if err != nil {
+		if !api.StatusErrorCheck(err, http.StatusNotFound) {
+			return err
+		}
+
+		log.Printf("image sync creating alias %v on %v\n", alias, host)
+		req := api.ImageAliasesPost{}
+		req.Name = alias
+		req.Target = fingerprint
+		return conn.CreateImageAlias(req)
+	}
+
+	if entry.Target != fingerprint {
+		log.Printf("image sync moving alias %v on %v from %v to %v\n", alias, host, entry.Target, fingerprint)
+		return conn.UpdateImageAlias(alias, api.ImageAliasesEntryPut{Description: entry.Description, Target: fingerprint}, etag)
+	}
+
+	return nil
+}
+
+// connectImageServer connects to a public image server, protocol is either simplestreams or lxd
+func connectImageServer(server string, protocol string) (lxd.ImageServer, error) {
+	switch protocol {
+	case "simplestreams":
+		return lxd.ConnectSimpleStreams(server, nil)
+	case "lxd":
+		return lxd.ConnectPublicLXD(server, nil)
+	}
+
+	return nil, errors.New("unknown image server protocol " + protocol)
+}
+
+// resolveImage turns an alias into a fingerprint if we can, otherwise we assume we were given the fingerprint
+func resolveImage(server lxd.ImageServer, image string) string {
+	entry, _, err := server.GetImageAlias(image)
+	if err == nil {
+		return entry.Target
+	}
+
+	return image
+}
+
+// waitForImageCopy passes download progress from the copy operation to our progress func until it finishes
+func waitForImageCopy(op lxd.RemoteOperation, progress func(string)) error {
+	if progress != nil {
+		_, err := op.AddHandler(func(o api.Operation) {
+			if o.Metadata == nil {
+				return
+			}
+			if p, ok := o.Metadata["download_progress"]; ok {
+				progress(fmt.Sprintf("%v", p))
+			}
+		})
+		if err != nil {
+			// we can live without progress
+			log.Printf("could not watch image copy progress: %s\n", err.Error())
+		}
+	}
+
+	return op.Wait()
+}
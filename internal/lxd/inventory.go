@@ -0,0 +1,309 @@
+package lxd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// The inventory is our in memory copy of the containers, images and resources on every host.  Pages read from it
+// instead of asking every host every time.  A poller keeps it fresh in the background, container events and our own
+// changes update single containers as they happen, and anything older than Conf.Inventory.Age is refreshed before
+// it is handed out
+var inventory ContainerList
+var inventoryImages []ImageInfo
+var inventoryResources map[string]HostResourceInfo
+
+// when each part of the inventory was last refreshed, zero means it needs to be
+var inventoryUpdatedAt time.Time
+var inventoryImagesAt time.Time
+var inventoryResourcesAt time.Time
+
+// when the list behind the last full container refresh started, and host:project:name -> when the single container
+// update that last changed it started.  Between them we can tell which is newer when a full refresh and single
+// updates overlap
+var inventoryListedAt time.Time
+var inventoryTouched = make(map[string]time.Time)
+
+// mutex for the inventory and its times
+var inventoryMutex = &sync.RWMutex{}
+
+// refreshMutex makes sure only one refresh of each part runs at a time, anyone else waits for it and uses the result
+var refreshMutex = &sync.Mutex{}
+var refreshImagesMutex = &sync.Mutex{}
+var refreshResourcesMutex = &sync.Mutex{}
+
+// StartInventory fills the inventory, then starts a background goroutine refreshing it twice every Conf.Inventory.Age
+// so pages rarely have to wait on a refresh themselves
+func StartInventory() {
+	ticker := time.NewTicker(Conf.Inventory.Age / 2)
+	// normally we would have a channel to indicate we are done, but this will run until the main process exits
+	go func() {
+		RefreshInventory()
+		for range ticker.C {
+			RefreshInventory()
+		}
+	}()
+}
+
+// RefreshInventory refreshes every part of the inventory now, no matter how fresh it is
+func RefreshInventory() {
+	refreshContainers(0)
+	refreshImages(0)
+	refreshResources(0)
+}
+
+// InventoryUpdatedAt is when the container inventory was last refreshed in full
+func InventoryUpdatedAt() time.Time {
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	return inventoryUpdatedAt
+}
+
+// InventoryContainers returns the containers in the inventory, filtered like ListContainers, along with the hosts
+// that didn't answer the last refresh.  State is always included
+func InventoryContainers(host string, project string, name string) ContainerList {
+	refreshContainers(Conf.Inventory.Age)
+
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	var list ContainerList
+	for _, c := range inventory.Containers {
+		if (host == "" || c.Host.Host == host) && (project == "" || c.Project == project) && (name == "" || c.Container.Name == name) {
+			list.Containers = append(list.Containers, c)
+		}
+	}
+	for _, f := range inventory.Failures {
+		if (host == "" || f.Host.Host == host) && (project == "" || f.Project == project) {
+			list.Failures = append(list.Failures, f)
+		}
+	}
+
+	return list
+}
+
+// InventoryImages returns the images on every host from the inventory, or just one host if given
+func InventoryImages(host string) []ImageInfo {
+	refreshImages(Conf.Inventory.Age)
+
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	var images []ImageInfo
+	for _, image := range inventoryImages {
+		if host == "" || image.Host.Host == host {
+			images = append(images, image)
+		}
+	}
+
+	return images
+}
+
+// InventoryHostResources returns the resources of every host from the inventory, or just one host if given
+func InventoryHostResources(host string) map[string]HostResourceInfo {
+	refreshResources(Conf.Inventory.Age)
+
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	resources := make(map[string]HostResourceInfo)
+	for h, info := range inventoryResources {
+		if host == "" || h == host {
+			resources[h] = info
+		}
+	}
+
+	return resources
+}
+
+// refreshContainers lists every container on every host if the inventory is older than maxAge.  Hosts that don't
+// answer lose their containers from the inventory until they do, the same as a live list would
+func refreshContainers(maxAge time.Duration) {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
+	// someone may have refreshed while we waited on the lock
+	if maxAge > 0 && time.Since(InventoryUpdatedAt()) < maxAge {
+		return
+	}
+
+	// we don't want a page that went away to leave us with a half done inventory, the timeouts in ListContainers
+	// keep this from taking too long
+	started := time.Now()
+	list := ListContainers(context.Background(), "", "", "", true)
+	for _, f := range list.Failures {
+		log.Printf("Inventory could not get containers from " + f.Error())
+	}
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	inventory = mergeInventory(inventory.Containers, list, started, inventoryTouched)
+	inventoryUpdatedAt = time.Now()
+	inventoryListedAt = started
+}
+
+// mergeInventory builds the new inventory from a full list that started at started.  Containers updated on their own
+// since then are newer than what the list has, so we keep our copy of them, or leave them out if they were deleted.
+// Anything updated before the list started is covered by it, so we stop tracking those
+func mergeInventory(current []ContainerInfo, list ContainerList, started time.Time, touched map[string]time.Time) ContainerList {
+	currentByKey := make(map[string]ContainerInfo)
+	for _, c := range current {
+		currentByKey[inventoryKey(c.Host.Host, c.Project, c.Container.Name)] = c
+	}
+
+	merged := ContainerList{Failures: list.Failures}
+	listed := make(map[string]bool)
+	for _, c := range list.Containers {
+		key := inventoryKey(c.Host.Host, c.Project, c.Container.Name)
+		listed[key] = true
+		if touched[key].Before(started) {
+			merged.Containers = append(merged.Containers, c)
+		} else if cur, ok := currentByKey[key]; ok {
+			merged.Containers = append(merged.Containers, cur)
+		}
+	}
+
+	// and the ones that showed up after the list started
+	for _, c := range current {
+		key := inventoryKey(c.Host.Host, c.Project, c.Container.Name)
+		if !listed[key] && !touched[key].Before(started) {
+			merged.Containers = insertContainer(merged.Containers, c)
+		}
+	}
+
+	for key, t := range touched {
+		if t.Before(started) {
+			delete(touched, key)
+		}
+	}
+
+	return merged
+}
+
+// refreshImages gets the images on every host if the image inventory is older than maxAge
+func refreshImages(maxAge time.Duration) {
+	refreshImagesMutex.Lock()
+	defer refreshImagesMutex.Unlock()
+
+	inventoryMutex.RLock()
+	updatedAt := inventoryImagesAt
+	inventoryMutex.RUnlock()
+	if maxAge > 0 && time.Since(updatedAt) < maxAge {
+		return
+	}
+
+	images, err := GetImages("")
+	if err != nil {
+		log.Printf("Inventory could not get images %s\n", err.Error())
+	}
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	inventoryImages = images
+	inventoryImagesAt = time.Now()
+}
+
+// refreshResources gets the resources of every host if the resource inventory is older than maxAge
+func refreshResources(maxAge time.Duration) {
+	refreshResourcesMutex.Lock()
+	defer refreshResourcesMutex.Unlock()
+
+	inventoryMutex.RLock()
+	updatedAt := inventoryResourcesAt
+	inventoryMutex.RUnlock()
+	if maxAge > 0 && time.Since(updatedAt) < maxAge {
+		return
+	}
+
+	resources, err := GetHostResources("")
+	if err != nil {
+		log.Printf("Inventory could not get host resources %s\n", err.Error())
+	}
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	inventoryResources = resources
+	inventoryResourcesAt = time.Now()
+}
+
+// expireInventoryImages makes the next read of the images refresh them, for after we change them
+func expireInventoryImages() {
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	inventoryImagesAt = time.Time{}
+}
+
+// refreshInventoryContainer updates a single container in the inventory from its host, removing it if it is no
+// longer there.  This is how we keep up with events and our own changes without listing everything again
+func refreshInventoryContainer(host string, project string, name string) {
+	started := time.Now()
+	c, err := getContainer(host, project, name)
+	if err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+		// we can't tell what happened to it, so leave it for the next full refresh
+		log.Printf("Inventory could not get " + name + " from " + host + " : " + err.Error())
+		return
+	}
+	exists := err == nil
+	if exists {
+		state, err := GetContainerState(host, project, name)
+		if err == nil {
+			c.State = state
+			c.Usage["cpu"] = cpuUsage(c)
+		}
+	}
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	// a full refresh or another update that started after us already has something newer
+	key := inventoryKey(host, project, name)
+	if started.Before(inventoryListedAt) || started.Before(inventoryTouched[key]) {
+		return
+	}
+	inventoryTouched[key] = started
+
+	for i, ic := range inventory.Containers {
+		if ic.Host.Host == host && ic.Project == project && ic.Container.Name == name {
+			if exists {
+				inventory.Containers[i] = c
+			} else {
+				inventory.Containers = append(inventory.Containers[:i], inventory.Containers[i+1:]...)
+			}
+			return
+		}
+	}
+	if exists {
+		inventory.Containers = insertContainer(inventory.Containers, c)
+	}
+}
+
+// insertContainer adds a container after the rest of the containers in its project, to keep the config ordering of
+// hosts.  The first container in its project goes on the end, it will find its proper spot on the next full refresh
+func insertContainer(containers []ContainerInfo, c ContainerInfo) []ContainerInfo {
+	insert := -1
+	for i, ic := range containers {
+		if ic.Host.Host == c.Host.Host && ic.Project == c.Project {
+			insert = i + 1
+		}
+	}
+	if insert < 0 {
+		return append(containers, c)
+	}
+
+	return append(containers[:insert], append([]ContainerInfo{c}, containers[insert:]...)...)
+}
+
+// inventoryKey is how we track single containers in the inventory
+func inventoryKey(host string, project string, name string) string {
+	return host + ":" + project + ":" + name
+}
@@ -0,0 +1,57 @@
+package lxd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lxc/lxd/shared/api"
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+func TestMergeInventory(t *testing.T) {
+	host := &config.LXDhost{Host: "host1"}
+	container := func(name string, status string) ContainerInfo {
+		return ContainerInfo{Host: host, Project: "default", Container: api.Instance{Name: name, Status: status}}
+	}
+
+	started := time.Now()
+	before := started.Add(-time.Second)
+	after := started.Add(time.Second)
+
+	// what the full list saw, and what we have now after single updates while it ran
+	list := ContainerList{Containers: []ContainerInfo{
+		container("old", "Running"),
+		container("deleted", "Running"),
+		container("started", "Stopped"),
+		container("stale", "Running"),
+	}}
+	current := []ContainerInfo{
+		container("old", "Running"),
+		container("started", "Running"),
+		container("created", "Stopped"),
+		container("stale", "Stopped"),
+	}
+	touched := map[string]time.Time{
+		inventoryKey("host1", "default", "deleted"): after,
+		inventoryKey("host1", "default", "started"): after,
+		inventoryKey("host1", "default", "created"): after,
+		inventoryKey("host1", "default", "stale"):   before,
+	}
+
+	merged := mergeInventory(current, list, started, touched)
+
+	expected := []string{"old:Running", "started:Running", "stale:Running", "created:Stopped"}
+	if len(merged.Containers) != len(expected) {
+		t.Fatalf("Expected %v got %v containers", expected, len(merged.Containers))
+	}
+	for i, c := range merged.Containers {
+		if c.Container.Name+":"+c.Container.Status != expected[i] {
+			t.Errorf("Expected %v at %v got %v:%v", expected[i], i, c.Container.Name, c.Container.Status)
+		}
+	}
+
+	// updates from before the list started are covered by it now
+	if _, ok := touched[inventoryKey("host1", "default", "stale")]; ok || len(touched) != 3 {
+		t.Errorf("Expected only the updates after the list started to be tracked got %v", touched)
+	}
+}
@@ -2,13 +2,15 @@
 package lxd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math"
-	"os"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	lxd "github.com/lxc/lxd/client"
@@ -19,15 +21,14 @@ import (
 // Conf is our main config
 var Conf *config.Config
 
-// cache of connections to our LXD servers
-var lxdConnections = make(map[string]lxd.ContainerServer)
-
-// ContainerInfo is a conversion / grouping of useful container information as returned from the lxd client
+// ContainerInfo is a conversion / grouping of useful container information as returned from the lxd client.
+// These are really LXD instances, so a "container" here can also be a virtual machine, check Container.Type
 type ContainerInfo struct {
-	Host      *config.LXDhost     // Host details
-	Container api.Container       // Container details returned from lxd.GetContainers
-	State     *api.ContainerState // Container state from lxd.GetContainerState
-	Usage     map[string]float64  // place to store usge conversions, like CPU usage
+	Host      *config.LXDhost    // Host details
+	Project   string             // LXD project the container is in
+	Container api.Instance       // Container details returned from lxd.GetContainers
+	State     *api.InstanceState // Container state from lxd.GetContainerState
+	Usage     map[string]float64 // place to store usge conversions, like CPU usage
 }
 
 // ImageInfo like above is a grouping of useful image information for the frontend
@@ -36,6 +37,9 @@ type ImageInfo struct {
 	Aliases      []api.ImageAlias // list of aliases this image goes by
 	Architecture string           // x86_64, etc
 	Fingerprint  string           // fingerprint hash of the image for comparison
+	Type         string           // container or virtual-machine
+	Size         int64            // size of the image in bytes
+	UploadedAt   time.Time        // when the image was added to the host
 }
 
 // HostResourceInfo is a group of Host and Resources as returned by lxd
@@ -44,109 +48,203 @@ type HostResourceInfo struct {
 	Resources *api.Resources
 }
 
-// DiscardCloser is a WriteCloser that just discards data.  When we exec commands on a container
-// stdout, etc need some place to go, but at the moment we don't care about the data.
-type DiscardCloser struct{}
+// SnapshotInfo is the subset of snapshot information we show in the UI
+type SnapshotInfo struct {
+	Name      string    // snapshot name without the container prefix
+	CreatedAt time.Time // when the snapshot was taken
+	Stateful  bool      // whether the running state was captured as well
+}
 
-// Write just sends its data to the io.Discard object
-func (DiscardCloser) Write(b []byte) (int, error) {
-	return io.Discard.Write(b)
+// HostFailure is a host, or a project on a host, we couldn't get containers from
+type HostFailure struct {
+	Host    *config.LXDhost // Host details
+	Project string          // LXD project we were asking about
+	Err     error           // what went wrong, including timing out
 }
 
-// Close does nothing and is there just to satisfy the WriteCloser interface
-func (DiscardCloser) Close() error {
-	return nil
+// Error lets a HostFailure be returned as an error
+func (f HostFailure) Error() string {
+	return f.Host.Name + " (" + f.Project + ") : " + f.Err.Error()
 }
 
-// GetContainers asks for a list of containers from each LXD host, then optionally calls GetContainerState
-// on each container to populate state information (IP, CPU / Memory / Disk usage, etc)
-func GetContainers(host string, name string, getState bool) ([]ContainerInfo, error) {
-	var containerInfo []ContainerInfo
+// ContainerList is every container we could find, along with the places we couldn't look.  If Failures isn't empty
+// the list is missing anything on those hosts
+type ContainerList struct {
+	Containers []ContainerInfo
+	Failures   []HostFailure
+}
+
+// hostQueryTimeout is how long a host has to give us its list of containers
+const hostQueryTimeout = 5 * time.Second
+
+// stateQueryTimeout is how long we wait on all the container states, anything that isn't back by then keeps the
+// blank state we started with
+const stateQueryTimeout = 10 * time.Second
+
+// stateConcurrency is how many state requests we have out to a single host at once
+const stateConcurrency = 10
+
+// GetContainers is ListContainers for callers that just want the containers.  Asking about a single host is
+// asking about something on it, so not hearing back is an error.  Across every host we return what we could,
+// like we always have for hosts we can't connect to, and log the rest
+func GetContainers(host string, project string, name string, getState bool) ([]ContainerInfo, error) {
+	list := ListContainers(context.Background(), host, project, name, getState)
 
-	// Always try to loop over the config array of hosts so we maintain the same ordering
+	for _, f := range list.Failures {
+		log.Printf("Could not get containers from " + f.Error())
+	}
+	if host != "" && len(list.Failures) > 0 {
+		return list.Containers, list.Failures[0]
+	}
+
+	return list.Containers, nil
+}
+
+// ListContainers asks every LXD host for its containers at the same time, then optionally calls GetContainerState
+// on each container to populate state information (IP, CPU / Memory / Disk usage, etc).  A blank project
+// looks in every project we manage on the host.  Each host gets hostQueryTimeout to answer, hosts that don't,
+// or error, end up in Failures instead of holding up everyone else
+func ListContainers(ctx context.Context, host string, project string, name string, getState bool) ContainerList {
+	// each host and project gets its own slot, so no matter who answers first we keep the ordering of hosts
+	// in the config, which is something we want to be consistent with
+	type query struct {
+		lxdh       *config.LXDhost
+		project    string
+		containers []ContainerInfo
+		err        error
+	}
+	var queries []*query
 	for _, lxdh := range Conf.LXDhosts {
 		if host == "" || lxdh.Host == host {
-			conn, err := getConnection(lxdh.Host)
-			if err != nil {
-				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
-				continue
+			for _, p := range lxdh.Projects {
+				if project == "" || p == project {
+					queries = append(queries, &query{lxdh: lxdh, project: p})
+				}
 			}
+		}
+	}
 
-			// annoyingly this doesn't return all the state information we want too, so we just get a list of containers
-			containers, err := conn.GetContainers()
-			if err != nil {
-				return containerInfo, err
-			}
+	var wg sync.WaitGroup
+	for _, q := range queries {
+		wg.Add(1)
+		go func(q *query) {
+			defer wg.Done()
+			q.containers, q.err = queryContainers(ctx, q.lxdh, q.project, name)
+		}(q)
+	}
+	wg.Wait()
 
-			// Take the list of containers we got back and put them into our array to return, this at least ensures
-			// the ordering of hosts in the order they were specfied in the config which is something we want to be
-			// consistent with
-			for _, container := range containers {
-				if name == "" || container.Name == name {
-					// Prepopulate a blank state in case we can't fetch it later
-					state := &api.ContainerState{}
-					tmp := ContainerInfo{
-						Host:      lxdh,
-						Container: container,
-						State:     state,
-						Usage:     make(map[string]float64),
-					}
-					containerInfo = append(containerInfo, tmp)
-				}
-			}
+	var list ContainerList
+	for _, q := range queries {
+		if q.err != nil {
+			list.Failures = append(list.Failures, HostFailure{Host: q.lxdh, Project: q.project, Err: q.err})
+			continue
 		}
+		list.Containers = append(list.Containers, q.containers...)
 	}
 
-	// If we want to fetch state, that more expensive as its a new call out for every container.  We will loop
-	// over our newly built array and make the call in a goroutine to at least parallelize that, or make it concurrent
-	// or something of that nature, maybe this helps?
+	// If we want to fetch state, that more expensive as its a new call out for every container
 	if getState {
-		done := make(chan int)
-		start := time.Now()
+		fetchContainerStates(ctx, list.Containers)
+	}
 
-		for idx, info := range containerInfo {
-			go func(info ContainerInfo, idx int) {
-				state, err := GetContainerState(info.Host.Host, info.Container.Name)
-				if err != nil {
-					log.Printf("Could not get container state from %v for %v", info.Host.Host, info.Container.Name)
-					return
-				}
+	return list
+}
+
+// queryContainers gets the containers in a single project on a host, giving up after hostQueryTimeout
+func queryContainers(ctx context.Context, lxdh *config.LXDhost, project string, name string) ([]ContainerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, hostQueryTimeout)
+	defer cancel()
 
-				// Drop the state in our array and calculate the cpu usage so we don't have to muck with that later, still not sure its right
-				containerInfo[idx].State = state
-				containerInfo[idx].Usage["cpu"] = (float64(state.CPU.Usage/1000000000) / math.Abs(time.Now().Sub(info.Container.LastUsedAt).Seconds())) * 100
-				done <- idx
-			}(info, idx)
+	// annoyingly this doesn't return all the state information we want too, so we just get a list of containers
+	containers, err := callWithContext(ctx, func() ([]api.Instance, error) {
+		conn, err := getConnection(lxdh.Host, project)
+		if err != nil {
+			return nil, err
 		}
+		return conn.GetInstances(api.InstanceTypeAny)
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, errors.New("no answer after " + hostQueryTimeout.String())
+	} else if err != nil {
+		return nil, err
+	}
 
-		// going to allow the fetches 10s to complete, or stop when we determined we got them all because our completed count
-		// is >= the total we have
-		total := len(containerInfo)
-		completed := 0
-		now := time.Now()
-		for completed < total && now.Sub(start).Seconds() < 10 {
-			select {
-			case <-done:
-				completed++
-			default:
-				break
-			}
-			now = time.Now()
+	var containerInfo []ContainerInfo
+	for _, container := range containers {
+		if name == "" || container.Name == name {
+			// Prepopulate a blank state in case we can't fetch it later
+			containerInfo = append(containerInfo, ContainerInfo{
+				Host:      lxdh,
+				Project:   project,
+				Container: container,
+				State:     &api.InstanceState{},
+				Usage:     make(map[string]float64),
+			})
 		}
 	}
 
 	return containerInfo, nil
 }
 
+// fetchContainerStates fills in the state of each container, with at most stateConcurrency requests out to any
+// one host so a big host doesn't get hammered.  Containers we don't hear back about in time keep their blank state
+func fetchContainerStates(ctx context.Context, containerInfo []ContainerInfo) {
+	ctx, cancel := context.WithTimeout(ctx, stateQueryTimeout)
+	defer cancel()
+
+	slots := make(map[string]chan bool)
+	for _, info := range containerInfo {
+		if _, ok := slots[info.Host.Host]; !ok {
+			slots[info.Host.Host] = make(chan bool, stateConcurrency)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for idx := range containerInfo {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			info := containerInfo[idx]
+
+			// wait for a free slot on the host, unless we are already out of time
+			select {
+			case slots[info.Host.Host] <- true:
+				defer func() { <-slots[info.Host.Host] }()
+			case <-ctx.Done():
+				return
+			}
+
+			state, err := callWithContext(ctx, func() (*api.InstanceState, error) {
+				return GetContainerState(info.Host.Host, info.Project, info.Container.Name)
+			})
+			if err != nil {
+				log.Printf("Could not get container state from %v for %v : %v", info.Host.Host, info.Container.Name, err)
+				return
+			}
+
+			// Drop the state in our array and calculate the cpu usage so we don't have to muck with that later
+			containerInfo[idx].State = state
+			containerInfo[idx].Usage["cpu"] = cpuUsage(containerInfo[idx])
+		}(idx)
+	}
+	wg.Wait()
+}
+
+// cpuUsage works out the percent of a cpu a container has used since it last started, still not sure its right
+func cpuUsage(c ContainerInfo) float64 {
+	return (float64(c.State.CPU.Usage/1000000000) / math.Abs(time.Now().Sub(c.Container.LastUsedAt).Seconds())) * 100
+}
+
 // GetContainerState calls out to our LXD host to get the state of the container.  State has data like network info,
 // memory usage, cpu seconds in use, running processes etc
-func GetContainerState(host string, name string) (*api.ContainerState, error) {
-	conn, err := getConnection(host)
+func GetContainerState(host string, project string, name string) (*api.InstanceState, error) {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return nil, err
 	}
 
-	state, _, err := conn.GetContainerState(name)
+	state, _, err := conn.GetInstanceState(name)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +258,7 @@ func GetImages(host string) ([]ImageInfo, error) {
 
 	for _, lxdh := range Conf.LXDhosts {
 		if host == "" || lxdh.Host == host {
-			conn, err := getConnection(lxdh.Host)
+			conn, err := getConnection(lxdh.Host, "")
 			if err != nil {
 				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
 				continue
@@ -177,6 +275,9 @@ func GetImages(host string) ([]ImageInfo, error) {
 					Aliases:      i.Aliases,
 					Architecture: i.Architecture,
 					Fingerprint:  i.Fingerprint,
+					Type:         i.Type,
+					Size:         i.Size,
+					UploadedAt:   i.UploadedAt,
 				}
 
 				images = append(images, tmp)
@@ -187,34 +288,40 @@ func GetImages(host string) ([]ImageInfo, error) {
 	return images, nil
 }
 
-// CreateContainer creates a container from the given image, with the provided name on the LXD host
-func CreateContainer(host string, name string, image string, storagepool string, options map[string]string) error {
-	conn, err := getConnection(host)
+// CreateContainer creates a container from the given image, with the provided name in a project on the LXD host.
+// If the host is clustered target picks the member to create it on, blank lets LXD decide.  instanceType is
+// container or virtual-machine, blank gets a container.  If no profiles are given LXD will apply its default profile.
+// network attaches eth0 to that network instead of whatever the profiles give it
+func CreateContainer(host string, project string, target string, name string, instanceType string, image string, storagepool string, network string, profiles []string, options map[string]string) error {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return err
 	}
+	if target != "" {
+		conn = conn.UseTarget(target)
+	}
+
+	if instanceType != "" && api.InstanceType(instanceType) != api.InstanceTypeContainer && api.InstanceType(instanceType) != api.InstanceTypeVM {
+		return errors.New("unknown instance type " + instanceType)
+	}
 
-	// We are going to grab a list of containers first to make sure someone isn't trying to create a duplicate name.
+	// We are going to check our inventory first to make sure someone isn't trying to create a duplicate name.
 	// Look at every host as we might want to move the container later, and you can't do that if there is already that
 	// name on a host, so our list of managed hosts is like a fake cluster
-	containerInfo, err := GetContainers("", "", false)
+	err = checkNameFree(project, name)
 	if err != nil {
 		return err
 	}
 
-	if len(containerInfo) > 0 {
-		for _, c := range containerInfo {
-			if c.Container.Name == name {
-				return errors.New("container already exists on " + c.Host.Name)
-			}
-		}
-	}
-
 	// Normally I wouldn't want to just trust the frontend, but this is an internal thing so whatever
-	put := api.ContainerPut{
+	put := api.InstancePut{
 		Config: options,
 	}
+	if len(profiles) > 0 {
+		put.Profiles = profiles
+	}
 
+	put.Devices = make(map[string]map[string]string)
 	if storagepool != "" && storagepool != "default" {
 		// Storage pools are set via devices
 		store := make(map[string]string)
@@ -222,23 +329,33 @@ func CreateContainer(host string, name string, image string, storagepool string,
 		store["pool"] = storagepool
 		store["type"] = "disk"
 
-		put.Devices = make(map[string]map[string]string)
 		put.Devices["root"] = store
 	}
 
+	if network != "" {
+		// Same goes for networks, a device named eth0 here replaces the one from the profile
+		nic := make(map[string]string)
+		nic["name"] = "eth0"
+		nic["network"] = network
+		nic["type"] = "nic"
+
+		put.Devices["eth0"] = nic
+	}
+
 	// Take the ContinerPut and initialize our Post, its inlined so just toss all the values in
-	req := api.ContainersPost{
-		ContainerPut: put,
-		Name:         name,
-		Source: api.ContainerSource{
+	req := api.InstancesPost{
+		InstancePut: put,
+		Name:        name,
+		Source: api.InstanceSource{
 			Type:  "image",
 			Alias: image,
 		},
 		InstanceType: "", // we just use the default which should be Persistent
+		Type:         api.InstanceType(instanceType),
 	}
 
 	// schedule the create with LXD, this happens in the background
-	op, err := conn.CreateContainer(req)
+	op, err := conn.CreateInstance(req)
 	if err != nil {
 		return err
 	}
@@ -249,46 +366,169 @@ func CreateContainer(host string, name string, image string, storagepool string,
 		return err
 	}
 
+	refreshInventoryContainer(host, project, name)
+
 	return nil
 }
 
-// StartContainer starts a stopped container
-func StartContainer(host string, name string) error {
-	conn, err := getConnection(host)
+// CloneContainer copies a container, or one of its snapshots if snapshot is set, to a new container on the same
+// or a different host.  The clone is made in the same project as the source, and is left stopped so the caller
+// can setup networking before starting it
+func CloneContainer(srcHost string, dstHost string, project string, name string, newName string, snapshot string) error {
+	srcconn, err := getConnection(srcHost, project)
 	if err != nil {
 		return err
 	}
 
-	// Grab container info to make sure our container isn't already running
-	containerInfo, err := GetContainers(host, name, false)
+	dstconn, err := getConnection(dstHost, project)
 	if err != nil {
 		return err
 	}
 
-	if len(containerInfo) > 0 {
-		for _, c := range containerInfo {
-			if c.Container.Name == name && c.Container.Status == "Running" {
-				// our container is already running so bail
-				return nil
-			}
+	// Like create, make sure the new name isn't in use anywhere in our "cluster"
+	err = checkNameFree(project, newName)
+	if err != nil {
+		return err
+	}
 
-			// don't allow remote management of anything we have locked, check that we have a LastUsedAt > 0
-			// which would mean that this container has booted at some point in the past.  If it is 0 then
-			// we just created it, so we want it to boot for the first time
-			if !IsManageable(c) && c.Container.LastUsedAt.Unix() > 0 {
-				return errors.New("lock flag set, remote management denied")
-			}
+	_, err = getContainer(srcHost, project, name)
+	if err != nil {
+		return err
+	}
+
+	var op lxd.RemoteOperation
+	if snapshot != "" {
+		snap, _, err := srcconn.GetInstanceSnapshot(name, snapshot)
+		if err != nil {
+			return err
+		}
+		// the client expects the snapshot name to be container/snapshot so it can find the parent
+		snap.Name = name + "/" + snapshot
+		cloneConfig(snap.Config)
+
+		args := &lxd.InstanceSnapshotCopyArgs{
+			Name: newName,
+		}
+		op, err = dstconn.CopyInstanceSnapshot(srcconn, name, *snap, args)
+		if err != nil {
+			return err
 		}
 	} else {
-		return errors.New("container does not exist")
+		container, _, err := srcconn.GetInstance(name)
+		if err != nil {
+			return err
+		}
+		cloneConfig(container.Config)
+
+		// only copy the container itself, the clone doesn't need the source's snapshots
+		args := &lxd.InstanceCopyArgs{
+			Name:         newName,
+			InstanceOnly: true,
+		}
+		op, err = dstconn.CopyInstance(srcconn, *container, args)
+		if err != nil {
+			return err
+		}
+	}
+
+	// wait for the copy to finish
+	err = op.Wait()
+	if err != nil {
+		return err
+	}
+
+	refreshInventoryContainer(dstHost, project, newName)
+
+	return nil
+}
+
+// cloneConfig strips the parts of a containers config a clone shouldn't inherit.  Our lock is for the source, the
+// clone is a new container the user asked for.  The volatile keys are the MAC addresses, idmaps, uuid and the like
+// LXD made for the source, leaving them would give the clone the same MAC as its source, so like lxc copy we drop
+// them all and let LXD make new ones
+func cloneConfig(config map[string]string) {
+	delete(config, "user.lxdepot_lock")
+	for key := range config {
+		if strings.HasPrefix(key, "volatile.") {
+			delete(config, key)
+		}
+	}
+}
+
+// RenameContainer renames a stopped container.  Like create we look across all our hosts to make sure the new name
+// isn't already in use
+func RenameContainer(host string, project string, name string, newName string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkNameFree(project, newName)
+	if err != nil {
+		return err
+	}
+
+	c, err := getContainer(host, project, name)
+	if err != nil {
+		return err
+	}
+	// don't allow remote management of anything we have locked
+	if !IsManageable(c) {
+		return errors.New("lock flag set, remote management denied")
+	}
+	if c.Container.Status != "Stopped" {
+		return errors.New("container must be stopped before renaming")
+	}
+
+	op, err := conn.RenameInstance(name, api.InstancePost{Name: newName})
+	if err != nil {
+		return err
+	}
+
+	// Like everything else this happens in the background, wait for it to finish
+	err = op.Wait()
+	if err != nil {
+		return err
+	}
+
+	// the old name is gone, and the new one is there
+	refreshInventoryContainer(host, project, name)
+	refreshInventoryContainer(host, project, newName)
+
+	return nil
+}
+
+// StartContainer starts a stopped container
+func StartContainer(host string, project string, name string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	// Grab the container to make sure it isn't already running
+	c, err := getContainer(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	if c.Container.Status == "Running" {
+		// our container is already running so bail
+		return nil
 	}
 
-	reqState := api.ContainerStatePut{
+	// don't allow remote management of anything we have locked, check that we have a LastUsedAt > 0
+	// which would mean that this container has booted at some point in the past.  If it is 0 then
+	// we just created it, so we want it to boot for the first time
+	if !IsManageable(c) && c.Container.LastUsedAt.Unix() > 0 {
+		return errors.New("lock flag set, remote management denied")
+	}
+
+	reqState := api.InstanceStatePut{
 		Action:  "start",
 		Timeout: -1,
 	}
 
-	op, err := conn.UpdateContainerState(name, reqState, "")
+	op, err := conn.UpdateInstanceState(name, reqState, "")
 	if err != nil {
 		return err
 	}
@@ -299,44 +539,40 @@ func StartContainer(host string, name string) error {
 		return err
 	}
 
+	refreshInventoryContainer(host, project, name)
+
 	return nil
 }
 
 // StopContainer stops a running container
-func StopContainer(host string, name string) error {
-	conn, err := getConnection(host)
+func StopContainer(host string, project string, name string) error {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return err
 	}
 
-	// Grab container info to make sure our container is actually running
-	containerInfo, err := GetContainers(host, name, false)
+	// Grab the container to make sure it is actually running
+	c, err := getContainer(host, project, name)
 	if err != nil {
 		return err
 	}
 
-	if len(containerInfo) > 0 {
-		for _, c := range containerInfo {
-			if c.Container.Name == name && c.Container.Status == "Stopped" {
-				// our container is already stopped so bail
-				return nil
-			}
+	if c.Container.Status == "Stopped" {
+		// our container is already stopped so bail
+		return nil
+	}
 
-			// don't allow remote management of anything we have locked
-			if !IsManageable(c) {
-				return errors.New("lock flag set, remote management denied")
-			}
-		}
-	} else {
-		return errors.New("container does not exist")
+	// don't allow remote management of anything we have locked
+	if !IsManageable(c) {
+		return errors.New("lock flag set, remote management denied")
 	}
 
-	reqState := api.ContainerStatePut{
+	reqState := api.InstanceStatePut{
 		Action:  "stop",
 		Timeout: -1,
 	}
 
-	op, err := conn.UpdateContainerState(name, reqState, "")
+	op, err := conn.UpdateInstanceState(name, reqState, "")
 	if err != nil {
 		return err
 	}
@@ -347,34 +583,24 @@ func StopContainer(host string, name string) error {
 		return err
 	}
 
+	refreshInventoryContainer(host, project, name)
+
 	return nil
 }
 
 // DeleteContainer removes a container from a host
-func DeleteContainer(host string, name string) error {
-	conn, err := getConnection(host)
+func DeleteContainer(host string, project string, name string) error {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return err
 	}
 
-	// Get container list to make sure we actually have a container with this name
-	containerInfo, err := GetContainers(host, name, false)
+	err = checkManageable(host, project, name)
 	if err != nil {
 		return err
 	}
 
-	if len(containerInfo) > 0 {
-		for _, c := range containerInfo {
-			// don't allow remote management of anything we have locked
-			if !IsManageable(c) {
-				return errors.New("lock flag set, remote management denied")
-			}
-		}
-	} else {
-		return errors.New("container does not exist")
-	}
-
-	op, err := conn.DeleteContainer(name)
+	op, err := conn.DeleteInstance(name)
 	if err != nil {
 		return err
 	}
@@ -385,6 +611,8 @@ func DeleteContainer(host string, name string) error {
 		return err
 	}
 
+	refreshInventoryContainer(host, project, name)
+
 	return nil
 }
 
@@ -396,7 +624,7 @@ func GetHostResources(host string) (map[string]HostResourceInfo, error) {
 		if host == "" || lxdh.Host == host {
 			resources := &api.Resources{}
 
-			conn, err := getConnection(lxdh.Host)
+			conn, err := getConnection(lxdh.Host, "")
 			if err != nil {
 				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
 			} else {
@@ -422,7 +650,7 @@ func GetStoragePools(host string) (map[string][]string, error) {
 
 	for _, lxdh := range Conf.LXDhosts {
 		if host == "" || lxdh.Host == host {
-			conn, err := getConnection(lxdh.Host)
+			conn, err := getConnection(lxdh.Host, "")
 			if err != nil {
 				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
 				continue
@@ -443,8 +671,8 @@ func GetStoragePools(host string) (map[string][]string, error) {
 
 // CreateFile creates a file or directory on the container.  If the provided path ends in / we assume
 // that we are creating a directory
-func CreateFile(host string, name string, path string, mode int, contents string) error {
-	conn, err := getConnection(host)
+func CreateFile(host string, project string, name string, path string, mode int, contents string) error {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return err
 	}
@@ -454,13 +682,13 @@ func CreateFile(host string, name string, path string, mode int, contents string
 		filetype = "directory"
 	}
 
-	args := lxd.ContainerFileArgs{
+	args := lxd.InstanceFileArgs{
 		Content: strings.NewReader(contents),
 		Mode:    mode,
 		Type:    filetype,
 	}
 
-	err = conn.CreateContainerFile(name, path, args)
+	err = conn.CreateInstanceFile(name, path, args)
 	if err != nil {
 		return err
 	}
@@ -468,181 +696,319 @@ func CreateFile(host string, name string, path string, mode int, contents string
 	return nil
 }
 
-// ExecCommand runs a command on the container and discards the output.  As further comments state,
-// there doesn't seem to be an accurate return of success or not, need to look for a status code return.
-// If a way is found, likely will stop discarding output and return that to the UI.  -1 is our return if
-// something outside the command went wrong
-func ExecCommand(host string, name string, command []string) (float64, error) {
-	conn, err := getConnection(host)
+// MoveContainer will move a container, along with its snapshots, from one server to another.  LXD does this
+// by having the destination copy the container and then we remove it from the source.  For a normal move the
+// container should already be stopped, for a live move it should be running and both hosts need CRIU.
+// If anything goes wrong we try to put things back the way they were by removing any copy we made on the
+// destination, the caller is responsible for starting the container back up if it stopped it.  The container
+// stays in the same project on the destination
+func MoveContainer(srcHost string, dstHost string, project string, name string, live bool) error {
+	srcconn, err := getConnection(srcHost, project)
 	if err != nil {
-		return -1, err
+		return err
 	}
 
-	cmd := api.ContainerExecPost{
-		Command:     command,
-		WaitForWS:   true,
-		Interactive: false,
+	dstconn, err := getConnection(dstHost, project)
+	if err != nil {
+		return err
 	}
 
-	// We can't seem to get an accurate answer if the command executes or not, so
-	// just going to toss the output until that changes
-	var ignore DiscardCloser
-	args := lxd.ContainerExecArgs{
-		Stdin:  os.Stdin,
-		Stdout: ignore,
-		Stderr: ignore,
+	if srcHost == dstHost {
+		return errors.New("container is already on " + dstHost)
 	}
 
-	// schedule the command to execute
-	op, err := conn.ExecContainer(name, cmd, &args)
+	err = checkManageable(srcHost, project, name)
 	if err != nil {
-		return -1, err
+		return err
 	}
 
-	// wait for the command to finish
-	err = op.Wait()
+	container, _, err := srcconn.GetInstance(name)
 	if err != nil {
-		return -1, err
+		return err
 	}
 
-	// Get the status of the command and convert the return value to a number
-	status := op.Get()
-	statuscode, ok := status.Metadata["return"].(float64)
-	if !ok {
-		return -1, errors.New("failed to parse return value")
+	if live && container.Status != "Running" {
+		return errors.New("live moves need a running container")
+	} else if !live && container.Status != "Stopped" {
+		return errors.New("container must be stopped before moving")
 	}
 
-	return statuscode, nil
-}
+	// the cleanup below removes whatever the copy leaves behind on the destination, so make sure nothing is there
+	// with this name before we start, otherwise we would be removing someone elses container
+	_, _, err = dstconn.GetInstance(name)
+	if err == nil {
+		return errors.New("container already exists on " + dstHost)
+	} else if !api.StatusErrorCheck(err, http.StatusNotFound) {
+		return err
+	}
 
-// MoveContainer will move (copy in lxd speak) a container from one server to another.
-func MoveContainer(srcHost string, dstHost string, name string) error {
-	// copy works by first marking the container as ready for migration, then connecting to the
-	// destination and telling it to make a copy, then probably deleting from the source
-	srcconn, err := getConnection(srcHost)
+	// relay mode has us shuttle the data between the hosts, which means they don't need to be able to
+	// talk to each other, only we need to be able to talk to both of them
+	args := &lxd.InstanceCopyArgs{
+		Live: live,
+		Mode: "relay",
+	}
+	op, err := dstconn.CopyInstance(srcconn, *container, args)
+	if err == nil {
+		err = op.Wait()
+	}
 	if err != nil {
+		// the copy may have left a partial container behind on the destination, clean that up.  We know there was
+		// nothing there before, so anything there now is ours
+		err2 := removeContainer(dstconn, name)
+		if err2 != nil {
+			return fmt.Errorf("error copying container (%v) error while removing the copy from %v (%v)", err, dstHost, err2)
+		}
 		return err
 	}
 
-	dstconn, err := getConnection(dstHost)
+	// And finally remove the container from the source, a live move can leave the source running so
+	// removeContainer will stop it first if need be.  If this fails remove the copy instead so we don't
+	// end up with 2 of the same container
+	err = removeContainer(srcconn, name)
 	if err != nil {
+		err2 := removeContainer(dstconn, name)
+		if err2 != nil {
+			return fmt.Errorf("error removing container from %v (%v) error while removing the copy from %v (%v)", srcHost, err, dstHost, err2)
+		}
 		return err
 	}
 
-	// Get container list to make sure we actually have a container with this name
-	containerInfo, err := GetContainers(srcHost, name, false)
+	refreshInventoryContainer(srcHost, project, name)
+	refreshInventoryContainer(dstHost, project, name)
+
+	return nil
+}
+
+// removeContainer is a helper for MoveContainer that forcefully stops a container if needed and then deletes it.
+// It skips all the checks DeleteContainer does since we have already made them, and a container that doesn't exist
+// isn't an error here since we are just cleaning up
+func removeContainer(conn lxd.InstanceServer, name string) error {
+	container, _, err := conn.GetInstance(name)
+	if err != nil {
+		// nothing to remove
+		return nil
+	}
+
+	if container.Status != "Stopped" {
+		reqState := api.InstanceStatePut{
+			Action:  "stop",
+			Timeout: -1,
+			Force:   true,
+		}
+
+		op, err := conn.UpdateInstanceState(name, reqState, "")
+		if err != nil {
+			return err
+		}
+
+		err = op.Wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	op, err := conn.DeleteInstance(name)
 	if err != nil {
 		return err
 	}
 
-	if len(containerInfo) > 0 {
-		for _, c := range containerInfo {
-			// don't allow remote management of anything we have locked
-			if !IsManageable(c) {
-				return errors.New("lock flag set, remote management denied")
-			}
+	return op.Wait()
+}
+
+// GetSnapshots returns the list of snapshots for a container, oldest first
+func GetSnapshots(host string, project string, name string) ([]SnapshotInfo, error) {
+	var snapshotInfo []SnapshotInfo
+
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return snapshotInfo, err
+	}
+
+	snapshots, err := conn.GetInstanceSnapshots(name)
+	if err != nil {
+		return snapshotInfo, err
+	}
+
+	for _, snapshot := range snapshots {
+		// depending on the LXD version the name may come back as container/snapshot, we only want the latter
+		snapName := snapshot.Name
+		if idx := strings.LastIndex(snapName, "/"); idx >= 0 {
+			snapName = snapName[idx+1:]
 		}
-	} else {
-		return errors.New("container does not exist")
+
+		snapshotInfo = append(snapshotInfo, SnapshotInfo{
+			Name:      snapName,
+			CreatedAt: snapshot.CreatedAt,
+			Stateful:  snapshot.Stateful,
+		})
 	}
 
-	// set our migration status to true
-	err = toggleMigration(srcconn, name, true)
+	sort.Slice(snapshotInfo, func(i, j int) bool {
+		return snapshotInfo[i].CreatedAt.Before(snapshotInfo[j].CreatedAt)
+	})
+
+	return snapshotInfo, nil
+}
+
+// CreateSnapshot takes a snapshot of a container.  If snapshot is blank LXD will pick a name for us (snap0, snap1, ...)
+// and if stateful is set the running state of the container is saved as well, which requires CRIU on the host
+func CreateSnapshot(host string, project string, name string, snapshot string, stateful bool) error {
+	conn, err := getConnection(host, project)
 	if err != nil {
 		return err
 	}
 
-	// Now on the destination, try and copy it?
-	c := api.Container{
-		Name: name,
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
 	}
-	args := &lxd.ContainerCopyArgs{
-		Live: true,
+
+	req := api.InstanceSnapshotsPost{
+		Name:     snapshot,
+		Stateful: stateful,
 	}
-	op, err := dstconn.CopyContainer(srcconn, c, args)
+
+	op, err := conn.CreateInstanceSnapshot(name, req)
 	if err != nil {
-		err2 := toggleMigration(srcconn, name, false)
-		if err2 != nil {
-			return fmt.Errorf("Error copying container (%v) error while unmigrating container (%v)", err, err2)
-		}
 		return err
 	}
 
+	// Like everything else the snapshot happens in the background, wait for it to finish
 	err = op.Wait()
 	if err != nil {
-		err2 := toggleMigration(srcconn, name, false)
-		if err2 != nil {
-			return fmt.Errorf("Error copying container (%v) error while unmigrating container (%v)", err, err2)
-		}
 		return err
 	}
 
-	// And finally remove the container from the src, if this fails we aren't going to try to rollback anything
-	err = DeleteContainer(srcHost, name)
-	return err
+	return nil
 }
 
-// toggleMigration is a helper for MoveContainer to toggle the migration flag on / off if
-// we want to move it, or then later run into an error and need to flip it back
-func toggleMigration(conn lxd.ContainerServer, name string, migrate bool) error {
-	post := api.ContainerPost{
-		Migration: migrate,
-		Live:      migrate,
+// RestoreSnapshot rolls a container back to the given snapshot
+func RestoreSnapshot(host string, project string, name string, snapshot string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
 	}
 
-	// like other commands, get the operation and then wait on it, just return here, later
-	// if we hit an error we probably need to try to un-migrate the thing?
-	op, err := conn.MigrateContainer(name, post)
+	// we need to know if the snapshot was stateful, as restoring one of those needs us to ask for it
+	snap, _, err := conn.GetInstanceSnapshot(name, snapshot)
+	if err != nil {
+		return err
+	}
+
+	// restores are done by updating the container with the snapshot name in Restore
+	put := api.InstancePut{
+		Restore:  snapshot,
+		Stateful: snap.Stateful,
+	}
+
+	op, err := conn.UpdateInstance(name, put, "")
 	if err != nil {
 		return err
 	}
 
-	// TODO : OK, so the reason this doesn't return is once you kick off the migrate you need to
-	//        Then make a copy request to run at the same time.  In experimenting with this I keep
-	//        getting an error "Architecture isn't supported:" which I can't find any info about
 	err = op.Wait()
-	return err
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-// IsManageable just checks our lock flag, user.lxdepot_lock to see if it is "true" or not
-func IsManageable(c ContainerInfo) bool {
-	// don't allow remote management of anything we have locked
-	if c.Container.ExpandedConfig["user.lxdepot_lock"] == "true" {
-		return false
+// DeleteSnapshot removes a snapshot from a container
+func DeleteSnapshot(host string, project string, name string, snapshot string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
 	}
 
-	return true
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.DeleteInstanceSnapshot(name, snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = op.Wait()
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-// getConnection will either return a cached connection, or reach out and make a new connection
-// to the host before caching that
-func getConnection(host string) (lxd.ContainerServer, error) {
-	if conn, ok := lxdConnections[host]; ok {
-		return conn, nil
+// checkNameFree makes sure no host has a container with this name in the project.  Each name gets one DNS record,
+// so this asks every host right now rather than trusting the inventory, and a host that doesn't answer could have
+// the name so we don't go ahead
+func checkNameFree(project string, name string) error {
+	list := ListContainers(context.Background(), "", project, name, false)
+	if len(list.Containers) > 0 {
+		return errors.New("container already exists on " + list.Containers[0].Host.Name)
+	}
+	if len(list.Failures) > 0 {
+		return errors.New("could not make sure the name is free, " + list.Failures[0].Error())
 	}
 
-	var lxdh *config.LXDhost
-	for _, h := range Conf.LXDhosts {
-		if h.Host == host {
-			lxdh = h
-		}
+	return nil
+}
+
+// checkManageable makes sure a container exists and does not have our lock flag set, returning an error if either
+// of those is not the case
+func checkManageable(host string, project string, name string) error {
+	c, err := getContainer(host, project, name)
+	if err != nil {
+		return err
 	}
 
-	if lxdh.Host == "" {
-		log.Fatal("Could not find lxdhost [" + host + "] in config\n")
+	// don't allow remote management of anything we have locked
+	if !IsManageable(c) {
+		return errors.New("lock flag set, remote management denied")
 	}
 
-	args := &lxd.ConnectionArgs{
-		TLSClientCert: Conf.Cert,
-		TLSClientKey:  Conf.Key,
-		TLSServerCert: lxdh.Cert,
+	return nil
+}
+
+// getContainer gets a single container straight from its host.  This is for when we are about to change a container
+// and need to know what it looks like right now, not what the inventory last saw.  State is left blank
+func getContainer(host string, project string, name string) (ContainerInfo, error) {
+	lxdh := getHost(host)
+	if lxdh == nil {
+		return ContainerInfo{}, errors.New("could not find lxdhost [" + host + "] in config")
+	}
+
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return ContainerInfo{}, err
 	}
-	conn, err := lxd.ConnectLXD("https://"+lxdh.Host+":"+lxdh.Port, args)
+
+	container, _, err := conn.GetInstance(name)
 	if err != nil {
-		return conn, err
+		return ContainerInfo{}, err
 	}
 
-	lxdConnections[host] = conn
+	return ContainerInfo{
+		Host:      lxdh,
+		Project:   project,
+		Container: *container,
+		State:     &api.InstanceState{},
+		Usage:     make(map[string]float64),
+	}, nil
+}
+
+// IsManageable just checks our lock flag, user.lxdepot_lock to see if it is "true" or not
+func IsManageable(c ContainerInfo) bool {
+	// don't allow remote management of anything we have locked
+	if c.Container.ExpandedConfig["user.lxdepot_lock"] == "true" {
+		return false
+	}
 
-	return conn, nil
+	return true
 }
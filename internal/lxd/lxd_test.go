@@ -0,0 +1,29 @@
+package lxd
+
+import (
+	"testing"
+)
+
+func TestCloneConfig(t *testing.T) {
+	config := map[string]string{
+		"limits.cpu":             "2",
+		"user.lxdepot_lock":      "true",
+		"user.note":              "keep me",
+		"volatile.eth0.hwaddr":   "00:16:3e:aa:bb:cc",
+		"volatile.idmap.current": "[]",
+		"volatile.uuid":          "2b8f7c4e-0000-0000-0000-000000000000",
+		"image.os":               "ubuntu",
+	}
+
+	cloneConfig(config)
+
+	expected := map[string]string{"limits.cpu": "2", "user.note": "keep me", "image.os": "ubuntu"}
+	if len(config) != len(expected) {
+		t.Errorf("Expected %v got %v", expected, config)
+	}
+	for key, value := range expected {
+		if config[key] != value {
+			t.Errorf("Expected %v=%v got %v", key, value, config[key])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package lxd
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+// NetworkInfo is the subset of network information we show in the UI
+type NetworkInfo struct {
+	Host        *config.LXDhost // Host details
+	Name        string          // network name, like lxdbr0 or eth0
+	Type        string          // bridge, macvlan, physical, etc
+	Managed     bool            // managed networks are created and configured by LXD, the rest are just host interfaces
+	Description string          // description set on the network
+	Status      string          // Created, Pending, Errored, etc for managed networks
+	IPv4        string          // ipv4.address for managed networks, which could also be none or auto
+	IPv6        string          // ipv6.address, like IPv4
+	UsedBy      []string        // instances and profiles using the network, like instances/NAME or profiles/default
+	Leases      []NetworkLease  // DHCP leases for managed bridges
+}
+
+// NetworkLease is a DHCP lease handed out by a managed bridge
+type NetworkLease struct {
+	Hostname string // instance name the lease is for
+	Hwaddr   string // MAC address
+	Address  string // IP address
+	Type     string // static or dynamic
+}
+
+// GetNetworks gets the networks on each host, along with the DHCP leases for any managed bridges.  Like images
+// and storage pools we only look at the default project
+func GetNetworks(host string) ([]NetworkInfo, error) {
+	var networkInfo []NetworkInfo
+
+	for _, lxdh := range Conf.LXDhosts {
+		if host == "" || lxdh.Host == host {
+			conn, err := getConnection(lxdh.Host, "")
+			if err != nil {
+				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			networks, err := conn.GetNetworks()
+			if err != nil {
+				return networkInfo, err
+			}
+
+			sort.Slice(networks, func(i, j int) bool {
+				return networks[i].Name < networks[j].Name
+			})
+
+			for _, n := range networks {
+				info := NetworkInfo{
+					Host:        lxdh,
+					Name:        n.Name,
+					Type:        n.Type,
+					Managed:     n.Managed,
+					Description: n.Description,
+					Status:      n.Status,
+					IPv4:        n.Config["ipv4.address"],
+					IPv6:        n.Config["ipv6.address"],
+				}
+
+				// these come back as API urls, which are a bit noisy to show
+				for _, u := range n.UsedBy {
+					info.UsedBy = append(info.UsedBy, strings.TrimPrefix(u, "/1.0/"))
+				}
+
+				// only LXD's own bridges run DHCP
+				if n.Managed && n.Type == "bridge" {
+					leases, err := conn.GetNetworkLeases(n.Name)
+					if err != nil {
+						log.Printf("Error getting leases for " + n.Name + " from " + lxdh.Host + " : " + err.Error())
+					}
+					for _, l := range leases {
+						info.Leases = append(info.Leases, NetworkLease{
+							Hostname: l.Hostname,
+							Hwaddr:   l.Hwaddr,
+							Address:  l.Address,
+							Type:     l.Type,
+						})
+					}
+				}
+
+				networkInfo = append(networkInfo, info)
+			}
+		}
+	}
+
+	return networkInfo, nil
+}
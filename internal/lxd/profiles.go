@@ -0,0 +1,112 @@
+package lxd
+
+import (
+	"errors"
+	"log"
+	"sort"
+)
+
+// GetProfiles gets a list of all the profiles available in a project for each host, blank is the default project
+func GetProfiles(host string, project string) (map[string][]string, error) {
+	profileMap := make(map[string][]string)
+
+	for _, lxdh := range Conf.LXDhosts {
+		if host == "" || lxdh.Host == host {
+			conn, err := getConnection(lxdh.Host, project)
+			if err != nil {
+				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			profiles, err := conn.GetProfileNames()
+			if err != nil {
+				log.Printf("Error getting profiles from " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			sort.Strings(profiles)
+			profileMap[lxdh.Host] = append(profileMap[lxdh.Host], profiles...)
+		}
+	}
+
+	return profileMap, nil
+}
+
+// AddProfile applies a profile to a container.  Profiles are applied in order, so this one is added to the end and
+// will override anything the earlier ones set
+func AddProfile(host string, project string, name string, profile string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := conn.GetProfileNames()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, p := range profiles {
+		if p == profile {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("profile " + profile + " does not exist on " + host)
+	}
+
+	container, etag, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range container.Profiles {
+		if p == profile {
+			return errors.New("profile " + profile + " is already applied")
+		}
+	}
+
+	put := container.Writable()
+	put.Profiles = append(put.Profiles, profile)
+
+	return updateContainer(conn, name, put, etag)
+}
+
+// RemoveProfile removes a profile from a container, anything the profile set goes away with it
+func RemoveProfile(host string, project string, name string, profile string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	err = checkManageable(host, project, name)
+	if err != nil {
+		return err
+	}
+
+	container, etag, err := conn.GetInstance(name)
+	if err != nil {
+		return err
+	}
+
+	put := container.Writable()
+	put.Profiles = nil
+	for _, p := range container.Profiles {
+		if p != profile {
+			put.Profiles = append(put.Profiles, p)
+		}
+	}
+	if len(put.Profiles) == len(container.Profiles) {
+		return errors.New("profile " + profile + " is not applied")
+	}
+	// LXD takes an empty list to mean no profiles, so make sure we send that and not null
+	if put.Profiles == nil {
+		put.Profiles = []string{}
+	}
+
+	return updateContainer(conn, name, put, etag)
+}
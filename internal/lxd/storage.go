@@ -0,0 +1,285 @@
+package lxd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/shared/api"
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+// StoragePoolInfo is a storage pool on a host along with how full it is
+type StoragePoolInfo struct {
+	Host   *config.LXDhost // Host details
+	Name   string          // pool name
+	Driver string          // dir, zfs, btrfs, lvm, etc
+	Status string          // Created, Pending, Errored, etc
+	Used   uint64          // bytes used
+	Total  uint64          // bytes available to the pool, 0 if the driver can't tell us
+}
+
+// StorageVolumeInfo is a custom storage volume, the kind we can attach to containers as a disk
+type StorageVolumeInfo struct {
+	Host        *config.LXDhost // Host details
+	Project     string          // LXD project the volume lives in
+	Pool        string          // pool the volume is on
+	Name        string          // volume name, this is the source when attaching it
+	Size        string          // size limit, blank if the pool doesn't limit it
+	ContentType string          // filesystem or block
+	UsedBy      []string        // instances using the volume, like instances/NAME
+	CreatedAt   time.Time       // when the volume was created
+}
+
+// GetStoragePoolUsage gets the storage pools for each host along with their used and total space
+func GetStoragePoolUsage(host string) (map[string][]StoragePoolInfo, error) {
+	poolMap := make(map[string][]StoragePoolInfo)
+
+	for _, lxdh := range Conf.LXDhosts {
+		if host == "" || lxdh.Host == host {
+			pools, err := getHostStoragePools(lxdh)
+			if err != nil {
+				log.Printf("Error getting pools from " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+			poolMap[lxdh.Host] = pools
+		}
+	}
+
+	return poolMap, nil
+}
+
+// ListStoragePoolUsage is GetStoragePoolUsage for a list of hosts, asking them all at the same time.  Like
+// ListContainers each host gets hostQueryTimeout to answer, and hosts that don't, or error, are returned as failures
+func ListStoragePoolUsage(ctx context.Context, hosts []string) (map[string][]StoragePoolInfo, []HostFailure) {
+	type query struct {
+		lxdh  *config.LXDhost
+		pools []StoragePoolInfo
+		err   error
+	}
+	var queries []*query
+	for _, host := range hosts {
+		if lxdh := getHost(host); lxdh != nil {
+			queries = append(queries, &query{lxdh: lxdh})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, q := range queries {
+		wg.Add(1)
+		go func(q *query) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, hostQueryTimeout)
+			defer cancel()
+			q.pools, q.err = callWithContext(ctx, func() ([]StoragePoolInfo, error) {
+				return getHostStoragePools(q.lxdh)
+			})
+			if errors.Is(q.err, context.DeadlineExceeded) {
+				q.err = errors.New("no answer after " + hostQueryTimeout.String())
+			}
+		}(q)
+	}
+	wg.Wait()
+
+	poolMap := make(map[string][]StoragePoolInfo)
+	var failures []HostFailure
+	for _, q := range queries {
+		if q.err != nil {
+			failures = append(failures, HostFailure{Host: q.lxdh, Err: q.err})
+			continue
+		}
+		poolMap[q.lxdh.Host] = q.pools
+	}
+
+	return poolMap, failures
+}
+
+// getHostStoragePools gets the storage pools on a single host along with their used and total space, sorted by name
+func getHostStoragePools(lxdh *config.LXDhost) ([]StoragePoolInfo, error) {
+	conn, err := getConnection(lxdh.Host, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := conn.GetStoragePools()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+
+	var poolInfo []StoragePoolInfo
+	for _, p := range pools {
+		info := StoragePoolInfo{
+			Host:   lxdh,
+			Name:   p.Name,
+			Driver: p.Driver,
+			Status: p.Status,
+		}
+
+		// a pool that is having problems may not give us its resources, we still want to list it
+		resources, err := conn.GetStoragePoolResources(p.Name)
+		if err != nil {
+			log.Printf("Error getting resources for pool " + p.Name + " from " + lxdh.Host + " : " + err.Error())
+		} else {
+			info.Used = resources.Space.Used
+			info.Total = resources.Space.Total
+		}
+
+		poolInfo = append(poolInfo, info)
+	}
+
+	return poolInfo, nil
+}
+
+// GetStorageVolumes gets the custom volumes on every pool of each host.  Volumes belong to projects like containers
+// do, so a blank project looks in every project we manage on the host
+func GetStorageVolumes(host string, project string) ([]StorageVolumeInfo, error) {
+	var volumeInfo []StorageVolumeInfo
+
+	for _, lxdh := range Conf.LXDhosts {
+		if host == "" || lxdh.Host == host {
+			// pools are shared by every project so we can just get them once
+			conn, err := getConnection(lxdh.Host, "")
+			if err != nil {
+				log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+
+			pools, err := conn.GetStoragePoolNames()
+			if err != nil {
+				log.Printf("Error getting pools from " + lxdh.Host + " : " + err.Error())
+				continue
+			}
+			sort.Strings(pools)
+
+			for _, p := range lxdh.Projects {
+				if project != "" && p != project {
+					continue
+				}
+
+				pconn, err := getConnection(lxdh.Host, p)
+				if err != nil {
+					log.Printf("Connection error to " + lxdh.Host + " : " + err.Error())
+					break
+				}
+
+				for _, pool := range pools {
+					volumes, err := pconn.GetStoragePoolVolumes(pool)
+					if err != nil {
+						return volumeInfo, err
+					}
+
+					sort.Slice(volumes, func(i, j int) bool {
+						return volumes[i].Name < volumes[j].Name
+					})
+
+					// the pool also has volumes for every container and image, we only want the ones people made
+					for _, v := range volumes {
+						if v.Type != "custom" {
+							continue
+						}
+
+						info := StorageVolumeInfo{
+							Host:        lxdh,
+							Project:     p,
+							Pool:        pool,
+							Name:        v.Name,
+							Size:        v.Config["size"],
+							ContentType: v.ContentType,
+							CreatedAt:   v.CreatedAt,
+						}
+						for _, u := range v.UsedBy {
+							info.UsedBy = append(info.UsedBy, strings.TrimPrefix(u, "/1.0/"))
+						}
+
+						volumeInfo = append(volumeInfo, info)
+					}
+				}
+			}
+		}
+	}
+
+	return volumeInfo, nil
+}
+
+// CreateStorageVolume creates a custom filesystem volume on a pool.  size is optional, and like limits.memory it
+// takes values like 10GiB.  Without one the volume can grow to fill the pool on drivers that allow it
+func CreateStorageVolume(host string, project string, pool string, name string, size string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	// volume names end up in paths on the host, so the same rules as device names work
+	if !deviceNameRegex.MatchString(name) {
+		return errors.New("invalid volume name")
+	}
+
+	req := api.StorageVolumesPost{
+		Name:        name,
+		Type:        "custom",
+		ContentType: "filesystem",
+	}
+	req.Config = make(map[string]string)
+	if size != "" {
+		if !byteSizeRegex.MatchString(size) {
+			return errors.New("invalid size, expected something like 10GiB")
+		}
+		req.Config["size"] = size
+	}
+
+	return conn.CreateStoragePoolVolume(pool, req)
+}
+
+// ResizeStorageVolume changes the size limit of a custom volume.  Most drivers can grow a volume while it is in use,
+// shrinking depends on the driver and usually needs the volume detached, we leave that for LXD to refuse
+func ResizeStorageVolume(host string, project string, pool string, name string, size string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	if !byteSizeRegex.MatchString(size) {
+		return errors.New("invalid size, expected something like 10GiB")
+	}
+
+	volume, etag, err := conn.GetStoragePoolVolume(pool, "custom", name)
+	if err != nil {
+		return err
+	}
+
+	put := volume.StorageVolumePut
+	if put.Config == nil {
+		put.Config = make(map[string]string)
+	}
+	put.Config["size"] = size
+
+	return conn.UpdateStoragePoolVolume(pool, "custom", name, put, etag)
+}
+
+// DeleteStorageVolume deletes a custom volume.  We won't delete one that is still attached to something, since
+// the whole point of them is to hold on to data, it has to be detached first
+func DeleteStorageVolume(host string, project string, pool string, name string) error {
+	conn, err := getConnection(host, project)
+	if err != nil {
+		return err
+	}
+
+	volume, _, err := conn.GetStoragePoolVolume(pool, "custom", name)
+	if err != nil {
+		return err
+	}
+
+	if len(volume.UsedBy) > 0 {
+		return errors.New("volume is still used by " + strings.TrimPrefix(volume.UsedBy[0], "/1.0/") + ", detach it first")
+	}
+
+	return conn.DeleteStoragePoolVolume(pool, "custom", name)
+}
@@ -0,0 +1,304 @@
+// Package placement picks a host for a new container when the user leaves the choice up to us.  Hosts that can't
+// take the container are ruled out first, then a policy ranks the rest
+package placement
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/neophenix/lxdepot/internal/config"
+	"github.com/neophenix/lxdepot/internal/lxd"
+	"github.com/neophenix/lxdepot/internal/utils"
+)
+
+// Conf is our main config
+var Conf *config.Config
+
+// Request is what we know about the container we are finding a home for
+type Request struct {
+	Project     string   // LXD project it will be created in
+	Type        string   // container or virtual-machine
+	Image       string   // image alias it will be created from
+	StoragePool string   // pool its root disk will be on
+	Tags        []string // tags the host needs to have, all of them
+	Memory      string   // limits.memory as given, blank for no limit
+	CPU         string   // limits.cpu as given, blank for no limit
+}
+
+// HostLoad is a host along with what is already promised to the containers on it
+type HostLoad struct {
+	Host            *config.LXDhost // Host details
+	MemoryTotal     uint64          // bytes of memory on the host
+	MemoryCommitted uint64          // bytes of memory set aside by the limits.memory of its containers
+	MemoryWanted    uint64          // bytes of memory the new container asks for, 0 if it has no limit
+	DiskFree        uint64          // bytes free in the requested storage pool
+	DiskTotal       uint64          // bytes in the requested storage pool, 0 if the driver can't tell us
+	Containers      int             // containers on the host, across every project we manage
+	Unfit           string          // why the host can't take the container, blank if it can
+}
+
+// Reason is what we thought of a single host
+type Reason struct {
+	Host    *config.LXDhost // Host details
+	Chosen  bool            // whether this is the host we picked
+	Message string          // why it scored what it did, or why it was ruled out
+}
+
+// Decision is the host we picked, along with what we thought of every host we looked at
+type Decision struct {
+	Host    *config.LXDhost // the host the container should go on
+	Policy  string          // name of the policy that picked it
+	Reasons []Reason        // every host we looked at, the chosen one first
+}
+
+// Place picks a host for the request using the named policy, blank for our default.  The reasons are filled in
+// even when no host can take the container, so the user can see why
+func Place(policyName string, req Request) (Decision, error) {
+	policy := New(policyName)
+	if policy == nil {
+		return Decision{}, errors.New("unknown placement policy " + policyName)
+	}
+
+	return choose(policy, loadHosts(req))
+}
+
+// choose ranks the hosts that can take the container with the policy and picks the best one, ties go to whichever
+// host is listed first in the config
+func choose(policy Policy, hosts []HostLoad) (Decision, error) {
+	decision := Decision{Policy: policy.Name()}
+
+	best := -1
+	bestScore := 0.0
+	for _, h := range hosts {
+		if h.Unfit != "" {
+			decision.Reasons = append(decision.Reasons, Reason{Host: h.Host, Message: "skipped, " + h.Unfit})
+			continue
+		}
+
+		score, why := policy.Score(h)
+		decision.Reasons = append(decision.Reasons, Reason{Host: h.Host, Message: why})
+		if best == -1 || score > bestScore {
+			best = len(decision.Reasons) - 1
+			bestScore = score
+		}
+	}
+
+	if best == -1 {
+		return decision, errors.New("no host can take this container")
+	}
+
+	chosen := decision.Reasons[best]
+	chosen.Chosen = true
+	decision.Host = chosen.Host
+	decision.Reasons = append([]Reason{chosen}, append(decision.Reasons[:best], decision.Reasons[best+1:]...)...)
+
+	return decision, nil
+}
+
+// loadHosts gathers what is on every host from the inventory, and rules out the hosts that can't take the container
+func loadHosts(req Request) []HostLoad {
+	resources := lxd.InventoryHostResources("")
+	containers := lxd.InventoryContainers("", "", "").Containers
+	images := lxd.InventoryImages("")
+	health := lxd.GetHostHealth()
+
+	var hosts []HostLoad
+	for _, lxdh := range Conf.LXDhosts {
+		h := HostLoad{Host: lxdh}
+
+		if hh := health[lxdh.Host]; !hh.CheckedAt.IsZero() && !hh.Online {
+			h.Unfit = "offline"
+		} else if tag := missingTag(lxdh, req.Tags); tag != "" {
+			h.Unfit = "not tagged " + tag
+		} else if !contains(lxdh.Projects, req.Project) {
+			h.Unfit = "project " + req.Project + " isn't managed here"
+		} else if !hasImage(images, lxdh.Host, req.Type, req.Image) {
+			h.Unfit = "no " + req.Image + " image"
+		} else {
+			loadHost(&h, req, resources[lxdh.Host], containers)
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	checkStoragePools(hosts, req.StoragePool)
+
+	return hosts
+}
+
+// checkStoragePools asks every host still in the running about its storage pools at the same time, so one slow host
+// only costs us the timeout, and rules out the hosts that don't have the pool or don't answer
+func checkStoragePools(hosts []HostLoad, pool string) {
+	if pool == "" {
+		pool = "default"
+	}
+
+	var names []string
+	for _, h := range hosts {
+		if h.Unfit == "" {
+			names = append(names, h.Host.Host)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	pools, failures := lxd.ListStoragePoolUsage(context.Background(), names)
+	failed := make(map[string]string)
+	for _, f := range failures {
+		failed[f.Host.Host] = f.Err.Error()
+	}
+
+	for i := range hosts {
+		h := &hosts[i]
+		if h.Unfit != "" {
+			continue
+		}
+		if err, ok := failed[h.Host.Host]; ok {
+			h.Unfit = "could not get storage pools, " + err
+			continue
+		}
+
+		h.Unfit = "no storage pool " + pool
+		for _, p := range pools[h.Host.Host] {
+			if p.Name == pool {
+				h.Unfit = ""
+				h.DiskTotal = p.Total
+				h.DiskFree = remaining(p.Total, p.Used)
+			}
+		}
+	}
+}
+
+// loadHost fills in how much of a host is already spoken for, and rules it out if the container won't fit.  The
+// storage pool is checked for every host together after this
+func loadHost(h *HostLoad, req Request, info lxd.HostResourceInfo, containers []lxd.ContainerInfo) {
+	if info.Resources == nil {
+		h.Unfit = "resources unknown"
+		return
+	}
+
+	if cpus := cpuLimit(req.CPU); cpus > info.Resources.CPU.Total {
+		h.Unfit = "only " + strconv.FormatUint(info.Resources.CPU.Total, 10) + " CPUs"
+		return
+	}
+
+	h.MemoryTotal = info.Resources.Memory.Total
+	h.MemoryWanted = memoryLimit(req.Memory, h.MemoryTotal)
+	for _, c := range containers {
+		if c.Host.Host == h.Host.Host {
+			h.Containers++
+			h.MemoryCommitted += memoryLimit(c.Container.ExpandedConfig["limits.memory"], h.MemoryTotal)
+		}
+	}
+	if h.MemoryWanted > 0 && h.MemoryCommitted+h.MemoryWanted > h.MemoryTotal {
+		h.Unfit = "only " + utils.MakeBytesMoreHuman(remaining(h.MemoryTotal, h.MemoryCommitted)) + " memory uncommitted"
+	}
+}
+
+// remaining is what is left of total after used, without wrapping around when more is used than there is
+func remaining(total uint64, used uint64) uint64 {
+	if used > total {
+		return 0
+	}
+
+	return total - used
+}
+
+// missingTag returns the first of the tags the host doesn't have, blank if it has them all
+func missingTag(lxdh *config.LXDhost, tags []string) string {
+	for _, tag := range tags {
+		if !contains(lxdh.Tags, tag) {
+			return tag
+		}
+	}
+
+	return ""
+}
+
+// hasImage checks for an image with the alias on the host that can be used for the type of instance
+func hasImage(images []lxd.ImageInfo, host string, instanceType string, alias string) bool {
+	for _, image := range images {
+		imageType := image.Type
+		if imageType == "" {
+			imageType = "container"
+		}
+		if image.Host.Host != host || (instanceType != "" && imageType != instanceType) {
+			continue
+		}
+		for _, a := range image.Aliases {
+			if a.Name == alias {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// memoryLimit converts a limits.memory value into bytes, a percentage is of the hosts memory.  Anything we can't
+// make sense of, including no limit at all, counts as 0
+func memoryLimit(value string, total uint64) uint64 {
+	if value == "" {
+		return 0
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseUint(strings.TrimSuffix(value, "%"), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return total * percent / 100
+	}
+
+	bytes, err := utils.ParseByteSize(value)
+	if err != nil {
+		return 0
+	}
+
+	return bytes
+}
+
+// cpuLimit is how many CPUs a limits.cpu value asks for.  A plain number is a count, otherwise it is a set of CPUs to
+// pin to like 0-1,4 and we count what is in it
+func cpuLimit(value string) uint64 {
+	if value == "" {
+		return 0
+	}
+
+	if count, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return count
+	}
+
+	var count uint64
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		low, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 64)
+		if err != nil {
+			continue
+		}
+		high := low
+		if len(bounds) == 2 {
+			high, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 64)
+			if err != nil || high < low {
+				continue
+			}
+		}
+		count += high - low + 1
+	}
+
+	return count
+}
+
+// contains is whether the list has the value in it
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/neophenix/lxdepot/internal/config"
+)
+
+func TestChoose(t *testing.T) {
+	one := &config.LXDhost{Host: "one", Name: "one"}
+	two := &config.LXDhost{Host: "two", Name: "two"}
+	three := &config.LXDhost{Host: "three", Name: "three"}
+	hosts := []HostLoad{
+		{Host: one, MemoryTotal: 100, MemoryCommitted: 50, DiskFree: 10, DiskTotal: 100, Containers: 5},
+		{Host: two, MemoryTotal: 100, MemoryCommitted: 20, DiskFree: 80, DiskTotal: 100, Containers: 2},
+		{Host: three, MemoryTotal: 100, MemoryCommitted: 0, Unfit: "offline"},
+	}
+
+	// Test 1, each policy picks the host it should, and never the unfit one
+	expected := map[string]*config.LXDhost{"least-memory": two, "most-disk": two, "spread": two, "bin-pack": one}
+	for name, host := range expected {
+		decision, err := choose(New(name), hosts)
+		if err != nil {
+			t.Errorf("T1: %v: Expected no error got %v", name, err)
+			continue
+		}
+		if decision.Host != host {
+			t.Errorf("T1: %v: Expected %v got %v", name, host.Name, decision.Host.Name)
+		}
+		if len(decision.Reasons) != 3 || decision.Reasons[0].Host != host || !decision.Reasons[0].Chosen {
+			t.Errorf("T1: %v: Expected the chosen host first in the reasons got %v", name, decision.Reasons)
+		}
+	}
+
+	// Test 2, ties go to the first host
+	hosts[1].Containers = 5
+	decision, _ := choose(New("spread"), hosts)
+	if decision.Host != one {
+		t.Errorf("T2: Expected one got %v", decision.Host.Name)
+	}
+
+	// Test 3, nothing fits so we get an error and still hear why
+	for i := range hosts {
+		hosts[i].Unfit = "offline"
+	}
+	decision, err := choose(New("spread"), hosts)
+	if err == nil || len(decision.Reasons) != 3 || decision.Reasons[0].Message != "skipped, offline" {
+		t.Errorf("T3: Expected an error and 3 reasons got %v %v", err, decision.Reasons)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	memory := map[string]uint64{
+		"":        0,
+		"512MB":   512000000,
+		"2GiB":    2147483648,
+		"1.5GB":   1500000000,
+		"1024":    1024,
+		"25%":     250,
+		"garbage": 0,
+	}
+	for value, bytes := range memory {
+		if got := memoryLimit(value, 1000); got != bytes {
+			t.Errorf("memoryLimit(%v): Expected %v got %v", value, bytes, got)
+		}
+	}
+
+	cpus := map[string]uint64{
+		"":      0,
+		"4":     4,
+		"0-3":   4,
+		"1,3":   2,
+		"0-1,4": 3,
+	}
+	for value, count := range cpus {
+		if got := cpuLimit(value); got != count {
+			t.Errorf("cpuLimit(%v): Expected %v got %v", value, count, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package placement
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/neophenix/lxdepot/internal/utils"
+)
+
+// The Policy interface is what each way of ranking hosts implements.  Only hosts that can take the container are
+// scored, and the highest score wins
+type Policy interface {
+	Name() string                       // what the policy is picked by in the config and on the form
+	Description() string                // a short explanation for the form
+	Score(h HostLoad) (float64, string) // how good a home the host is, and a short reason a person can follow
+}
+
+// policies are all the policies we know about, the first is the default.  Adding a policy is implementing Policy
+// and listing it here
+var policies = []Policy{leastMemory{}, mostDisk{}, spread{}, binPack{}}
+
+// Policies returns every policy we know about, in the order we show them
+func Policies() []Policy {
+	return policies
+}
+
+// New returns the policy with the name, blank is the configured default.  Like dns.New we hand back nil if we
+// don't know about it
+func New(name string) Policy {
+	if name == "" && Conf != nil {
+		name = Conf.Placement
+	}
+	if name == "" {
+		return policies[0]
+	}
+
+	for _, p := range policies {
+		if p.Name() == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// leastMemory picks the host with the smallest share of its memory committed to container limits
+type leastMemory struct{}
+
+func (leastMemory) Name() string { return "least-memory" }
+func (leastMemory) Description() string {
+	return "host with the least of its memory committed to container limits"
+}
+func (leastMemory) Score(h HostLoad) (float64, string) {
+	return -committedShare(h), memoryReason(h)
+}
+
+// mostDisk picks the host with the most free space in the storage pool the container will use
+type mostDisk struct{}
+
+func (mostDisk) Name() string        { return "most-disk" }
+func (mostDisk) Description() string { return "host with the most free space in the storage pool" }
+func (mostDisk) Score(h HostLoad) (float64, string) {
+	if h.DiskTotal == 0 {
+		return 0, "free space in the pool unknown"
+	}
+	return float64(h.DiskFree), utils.MakeBytesMoreHuman(h.DiskFree) + " of " + utils.MakeBytesMoreHuman(h.DiskTotal) + " free in the pool"
+}
+
+// spread picks the host with the fewest containers, so losing a host takes as few containers with it as we can
+type spread struct{}
+
+func (spread) Name() string        { return "spread" }
+func (spread) Description() string { return "host with the fewest containers" }
+func (spread) Score(h HostLoad) (float64, string) {
+	return -float64(h.Containers), strconv.Itoa(h.Containers) + " containers"
+}
+
+// binPack fills up the busiest host that still has room, keeping the others free for the big containers
+type binPack struct{}
+
+func (binPack) Name() string { return "bin-pack" }
+func (binPack) Description() string {
+	return "host with the most memory committed that still has room, keeping the rest free"
+}
+func (binPack) Score(h HostLoad) (float64, string) {
+	return committedShare(h), memoryReason(h)
+}
+
+// committedShare is how much of a hosts memory would be committed once the new container is on it, 0 to 1
+func committedShare(h HostLoad) float64 {
+	if h.MemoryTotal == 0 {
+		return 0
+	}
+	return float64(h.MemoryCommitted+h.MemoryWanted) / float64(h.MemoryTotal)
+}
+
+// memoryReason explains a memory based score
+func memoryReason(h HostLoad) string {
+	return fmt.Sprintf("%v of %v memory committed, %.0f%% with this container", utils.MakeBytesMoreHuman(h.MemoryCommitted), utils.MakeBytesMoreHuman(h.MemoryTotal), committedShare(h)*100)
+}
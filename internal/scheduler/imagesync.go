@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/config"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// ImageSyncStatus is the state of one synced image alias on one host as of the last time we checked
+type ImageSyncStatus struct {
+	Host        *config.LXDhost // the host this status is for
+	Expected    string          // fingerprint every host should have for the alias, blank if we couldn't work it out
+	Current     string          // fingerprint the alias points to on this host, blank if it doesn't exist
+	InSync      bool            // Current matches Expected
+	LastChecked time.Time       // when we last looked
+	LastSynced  time.Time       // when we last had to fix this host, zero if never
+	LastError   string          // error from the last check or sync, blank if it was successful
+}
+
+// ImageSyncReport is the status of one of our synced images across all the hosts
+type ImageSyncReport struct {
+	Image *config.SyncedImage
+	Hosts []ImageSyncStatus // in lxdhosts order
+}
+
+// alias -> host -> status
+var imageSyncStatus = make(map[string]map[string]*ImageSyncStatus)
+
+// mutex for our image sync status map
+var imageSyncMutex = &sync.RWMutex{}
+
+// held while a sync is running, so the scheduled run and a manual one don't step on each other
+var imageSyncRunning = &sync.Mutex{}
+
+// StartImageSync starts a background goroutine to make sure every host has our image set, on the schedule from the
+// config.  If there is no image set configured we don't bother starting anything
+func StartImageSync() {
+	if Conf.ImageSync == nil || len(Conf.ImageSync.Images) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(Conf.ImageSync.Interval)
+	// like snapshots this runs until the main process exits
+	go func() {
+		SyncImages()
+		for range ticker.C {
+			SyncImages()
+		}
+	}()
+}
+
+// SyncImages checks every image in our image set on every host, copying images and fixing aliases where they don't
+// match.  If a sync is already running this returns false without doing anything
+func SyncImages() bool {
+	if Conf.ImageSync == nil {
+		return false
+	}
+	if !imageSyncRunning.TryLock() {
+		return false
+	}
+	defer imageSyncRunning.Unlock()
+
+	for _, image := range Conf.ImageSync.Images {
+		syncImage(image, time.Now())
+	}
+
+	return true
+}
+
+// GetImageSyncReport returns the last known status of every image in our image set, in config order
+func GetImageSyncReport() []ImageSyncReport {
+	var reports []ImageSyncReport
+	if Conf.ImageSync == nil {
+		return reports
+	}
+
+	imageSyncMutex.RLock()
+	defer imageSyncMutex.RUnlock()
+
+	for _, image := range Conf.ImageSync.Images {
+		report := ImageSyncReport{Image: image}
+		for _, lxdh := range Conf.LXDhosts {
+			if status, ok := imageSyncStatus[image.Alias][lxdh.Host]; ok {
+				report.Hosts = append(report.Hosts, *status)
+			} else {
+				report.Hosts = append(report.Hosts, ImageSyncStatus{Host: lxdh})
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+// syncImage works out which fingerprint the alias should point to, and then makes each host match
+func syncImage(image *config.SyncedImage, now time.Time) {
+	expected, origin, err := expectedImage(image)
+
+	for _, lxdh := range Conf.LXDhosts {
+		status := ImageSyncStatus{Host: lxdh, Expected: expected, LastChecked: now}
+
+		imageSyncMutex.RLock()
+		if previous, ok := imageSyncStatus[image.Alias][lxdh.Host]; ok {
+			status.LastSynced = previous.LastSynced
+		}
+		imageSyncMutex.RUnlock()
+
+		current, cerr := lxd.GetImageAliasTarget(lxdh.Host, image.Alias)
+		status.Current = current
+
+		switch {
+		case cerr != nil:
+			status.LastError = cerr.Error()
+		case err != nil:
+			status.LastError = err.Error()
+		case current != expected:
+			serr := lxd.SyncImage(lxdh.Host, image.Alias, expected, origin)
+			if serr != nil {
+				log.Printf("image sync of %v to %v failed : %s\n", image.Alias, lxdh.Host, serr.Error())
+				status.LastError = serr.Error()
+			} else {
+				status.Current = expected
+				status.LastSynced = now
+			}
+		}
+		status.InSync = status.Expected != "" && status.Current == status.Expected
+
+		imageSyncMutex.Lock()
+		if imageSyncStatus[image.Alias] == nil {
+			imageSyncStatus[image.Alias] = make(map[string]*ImageSyncStatus)
+		}
+		imageSyncStatus[image.Alias][lxdh.Host] = &status
+		imageSyncMutex.Unlock()
+	}
+}
+
+// expectedImage returns the fingerprint an image alias should have everywhere, and where to copy it from.  Thats
+// the image server if one is configured, otherwise the first host with the alias
+func expectedImage(image *config.SyncedImage) (string, lxd.ImageOrigin, error) {
+	if image.Server != "" {
+		origin := lxd.ImageOrigin{Server: image.Server, Protocol: image.Protocol}
+		fingerprint, err := lxd.GetRemoteImageFingerprint(image.Server, image.Protocol, image.Image)
+		return fingerprint, origin, err
+	}
+
+	for _, lxdh := range Conf.LXDhosts {
+		fingerprint, err := lxd.GetImageAliasTarget(lxdh.Host, image.Alias)
+		if err != nil {
+			log.Printf("image sync could not check %v on %v : %s\n", image.Alias, lxdh.Host, err.Error())
+			continue
+		}
+		if fingerprint != "" {
+			return fingerprint, lxd.ImageOrigin{Host: lxdh.Host}, nil
+		}
+	}
+
+	return "", lxd.ImageOrigin{}, errors.New("alias not found on any host")
+}
@@ -0,0 +1,233 @@
+// Package scheduler runs our recurring background jobs, like taking scheduled snapshots and pruning
+// the old ones based on the retention set in each policy, or keeping our image set on every host
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/config"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+// Conf is our main config
+var Conf *config.Config
+
+// SnapshotStatus is the result of the last time a policy ran against a container, and when it should run next
+type SnapshotStatus struct {
+	Policy       *config.SnapshotPolicy // the policy this status is for
+	LastRun      time.Time              // when we last took (or tried to take) a snapshot, zero if never
+	LastSnapshot string                 // name of the last snapshot we took
+	LastError    string                 // error from the last run, blank if it was successful
+	NextRun      time.Time              // when we will next attempt a snapshot
+}
+
+// host:project:name -> policy name -> status
+var snapshotStatus = make(map[string]map[string]*SnapshotStatus)
+
+// mutex for our status map
+var mutex = &sync.RWMutex{}
+
+// snapshotTimeFormat is appended to the policy name to build our snapshot names, it sorts the same as the time
+const snapshotTimeFormat = "20060102-150405"
+
+// StartSnapshots starts a background goroutine to check every minute if any of our snapshot policies are due.
+// If there are no policies configured, we don't bother starting anything
+func StartSnapshots() {
+	if len(Conf.SnapshotPolicies) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(1 * time.Minute)
+	// normally we would have a channel to indicate we are done, but this will run until the main process exits
+	go func() {
+		runSnapshots(time.Now())
+		for now := range ticker.C {
+			runSnapshots(now)
+		}
+	}()
+}
+
+// GetSnapshotStatus returns the status of every policy that applies to a container, in config order
+func GetSnapshotStatus(host string, project string, name string) []SnapshotStatus {
+	var statuses []SnapshotStatus
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, policy := range Conf.SnapshotPolicies {
+		if status, ok := snapshotStatus[host+":"+project+":"+name][policy.Name]; ok {
+			statuses = append(statuses, *status)
+		}
+	}
+
+	return statuses
+}
+
+// runSnapshots grabs the list of containers across all hosts and for each policy that applies to a container
+// takes a snapshot if its due, then prunes old snapshots
+func runSnapshots(now time.Time) {
+	containerInfo, err := lxd.GetContainers("", "", "", false)
+	if err != nil {
+		log.Printf("snapshot scheduler could not get container list %s\n", err.Error())
+		return
+	}
+
+	for _, c := range containerInfo {
+		for _, policy := range Conf.SnapshotPolicies {
+			if !policyApplies(policy, c.Container.Name, c.Container.ExpandedConfig["user.lxdepot_snapshot_policy"]) {
+				continue
+			}
+
+			status := getStatus(c.Host.Host, c.Project, c.Container.Name, policy)
+			if now.Before(status.NextRun) {
+				continue
+			}
+
+			snapshot, err := takeSnapshot(c.Host.Host, c.Project, c.Container.Name, policy, snapshotStateful(policy, c.Container.Status), now)
+
+			mutex.Lock()
+			status.LastRun = now
+			status.NextRun = now.Add(policy.Interval)
+			status.LastError = ""
+			if err != nil {
+				status.LastError = err.Error()
+			} else {
+				status.LastSnapshot = snapshot
+			}
+			mutex.Unlock()
+		}
+	}
+}
+
+// getStatus returns the status for this container + policy, creating it if this is the first time we have
+// seen it.  On creation we look at any snapshots the policy previously took so a restart doesn't cause
+// us to immediately take another one
+func getStatus(host string, project string, name string, policy *config.SnapshotPolicy) *SnapshotStatus {
+	key := host + ":" + project + ":" + name
+
+	mutex.RLock()
+	status, ok := snapshotStatus[key][policy.Name]
+	mutex.RUnlock()
+	if ok {
+		return status
+	}
+
+	status = &SnapshotStatus{Policy: policy}
+	snapshots, err := lxd.GetSnapshots(host, project, name)
+	if err != nil {
+		log.Printf("snapshot scheduler could not get snapshots for %v on %v : %s\n", name, host, err.Error())
+	} else {
+		for _, snapshot := range snapshots {
+			if takenByPolicy(snapshot.Name, policy.Name) && snapshot.CreatedAt.After(status.LastRun) {
+				status.LastRun = snapshot.CreatedAt
+				status.LastSnapshot = snapshot.Name
+			}
+		}
+	}
+	if !status.LastRun.IsZero() {
+		status.NextRun = status.LastRun.Add(policy.Interval)
+	}
+
+	mutex.Lock()
+	if snapshotStatus[key] == nil {
+		snapshotStatus[key] = make(map[string]*SnapshotStatus)
+	}
+	snapshotStatus[key][policy.Name] = status
+	mutex.Unlock()
+
+	return status
+}
+
+// takeSnapshot creates the snapshot for this policy, and then removes any of this policy's snapshots past
+// the number we are supposed to retain
+func takeSnapshot(host string, project string, name string, policy *config.SnapshotPolicy, stateful bool, now time.Time) (string, error) {
+	snapshot := policy.Name + "-" + now.Format(snapshotTimeFormat)
+
+	log.Printf("snapshot scheduler creating %v/%v on %v\n", name, snapshot, host)
+	err := lxd.CreateSnapshot(host, project, name, snapshot, stateful)
+	if err != nil {
+		return "", err
+	}
+
+	snapshots, err := lxd.GetSnapshots(host, project, name)
+	if err != nil {
+		return snapshot, fmt.Errorf("snapshot created, but could not list snapshots to prune: %v", err)
+	}
+
+	for _, old := range snapshotsToPrune(snapshots, policy.Name, policy.Retain) {
+		log.Printf("snapshot scheduler removing %v/%v on %v\n", name, old, host)
+		err = lxd.DeleteSnapshot(host, project, name, old)
+		if err != nil {
+			return snapshot, fmt.Errorf("snapshot created, but could not prune %v: %v", old, err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// snapshotStateful is whether to save the running state in a policy's snapshot.  LXD refuses a stateful snapshot of a
+// stopped container, there is no state to save, so those get a normal snapshot instead of failing every time
+func snapshotStateful(policy *config.SnapshotPolicy, status string) bool {
+	return policy.Stateful && status == "Running"
+}
+
+// policyApplies checks if the policy names this container, or if the containers user.lxdepot_snapshot_policy
+// value (a comma separated list) has the policy in it
+func policyApplies(policy *config.SnapshotPolicy, name string, label string) bool {
+	for _, c := range policy.Containers {
+		if c == name {
+			return true
+		}
+	}
+
+	for _, l := range strings.Split(label, ",") {
+		if strings.TrimSpace(l) == policy.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// takenByPolicy is whether a snapshot has exactly the name a policy gives its snapshots, policy-YYYYMMDD-HHMMSS.  Just
+// looking at the prefix would also claim the snapshots of a policy like nightly-db for nightly, or one taken by hand
+// like nightly-before-upgrade
+func takenByPolicy(snapshot string, policy string) bool {
+	if !strings.HasPrefix(snapshot, policy+"-") {
+		return false
+	}
+	_, err := time.Parse(snapshotTimeFormat, strings.TrimPrefix(snapshot, policy+"-"))
+
+	return err == nil
+}
+
+// snapshotsToPrune returns the names of the snapshots taken by a policy that are beyond the number we want
+// to retain, oldest first.  Snapshots taken by hand or by other policies are left alone
+func snapshotsToPrune(snapshots []lxd.SnapshotInfo, policy string, retain int) []string {
+	var owned []lxd.SnapshotInfo
+	for _, snapshot := range snapshots {
+		if takenByPolicy(snapshot.Name, policy) {
+			owned = append(owned, snapshot)
+		}
+	}
+
+	if len(owned) <= retain {
+		return nil
+	}
+
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].CreatedAt.Before(owned[j].CreatedAt)
+	})
+
+	var prune []string
+	for _, snapshot := range owned[:len(owned)-retain] {
+		prune = append(prune, snapshot.Name)
+	}
+
+	return prune
+}
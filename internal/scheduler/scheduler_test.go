@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neophenix/lxdepot/internal/config"
+	"github.com/neophenix/lxdepot/internal/lxd"
+)
+
+func TestSnapshotsToPrune(t *testing.T) {
+	now := time.Now()
+	snapshots := []lxd.SnapshotInfo{
+		{Name: "nightly-20240103-000000", CreatedAt: now.Add(-1 * time.Hour)},
+		{Name: "nightly-20240101-000000", CreatedAt: now.Add(-3 * time.Hour)},
+		{Name: "before-upgrade", CreatedAt: now.Add(-10 * time.Hour)},
+		{Name: "nightly-20240102-000000", CreatedAt: now.Add(-2 * time.Hour)},
+		{Name: "hourly-20240101-000000", CreatedAt: now.Add(-4 * time.Hour)},
+		// another policy that starts with our name, and one taken by hand, neither are ours
+		{Name: "nightly-db-20240101-000000", CreatedAt: now.Add(-5 * time.Hour)},
+		{Name: "nightly-before-upgrade", CreatedAt: now.Add(-6 * time.Hour)},
+	}
+
+	// Test 1, we have fewer than we retain so nothing should go
+	prune := snapshotsToPrune(snapshots, "nightly", 7)
+	if len(prune) != 0 {
+		t.Errorf("T1: Expected nothing to prune got %v", prune)
+	}
+
+	// Test 2, keep 1 so the 2 oldest nightlies should go, oldest first, and nothing else
+	prune = snapshotsToPrune(snapshots, "nightly", 1)
+	if len(prune) != 2 || prune[0] != "nightly-20240101-000000" || prune[1] != "nightly-20240102-000000" {
+		t.Errorf("T2: Expected [nightly-20240101-000000 nightly-20240102-000000] got %v", prune)
+	}
+
+	// Test 3, the policy sharing our prefix only gets its own
+	prune = snapshotsToPrune(snapshots, "nightly-db", 0)
+	if len(prune) != 1 || prune[0] != "nightly-db-20240101-000000" {
+		t.Errorf("T3: Expected [nightly-db-20240101-000000] got %v", prune)
+	}
+}
+
+func TestTakenByPolicy(t *testing.T) {
+	cases := map[string]bool{
+		"nightly-20240101-000000":    true,
+		"nightly-db-20240101-000000": false,
+		"nightly-before-upgrade":     false,
+		"nightly-20240101":           false,
+		"before-upgrade":             false,
+	}
+	for name, expected := range cases {
+		if takenByPolicy(name, "nightly") != expected {
+			t.Errorf("%v: Expected %v", name, expected)
+		}
+	}
+}
+
+func TestSnapshotStateful(t *testing.T) {
+	stateful := &config.SnapshotPolicy{Name: "nightly", Stateful: true}
+	stateless := &config.SnapshotPolicy{Name: "nightly"}
+
+	if !snapshotStateful(stateful, "Running") {
+		t.Errorf("T1: Expected a stateful snapshot of a running container")
+	}
+	if snapshotStateful(stateful, "Stopped") {
+		t.Errorf("T2: Expected a normal snapshot of a stopped container")
+	}
+	if snapshotStateful(stateless, "Running") {
+		t.Errorf("T3: Expected a normal snapshot when the policy isn't stateful")
+	}
+}
+
+func TestPolicyApplies(t *testing.T) {
+	policy := &config.SnapshotPolicy{Name: "nightly", Containers: []string{"dev-alice-01"}}
+
+	if !policyApplies(policy, "dev-alice-01", "") {
+		t.Errorf("T1: Expected policy to apply by container name")
+	}
+	if !policyApplies(policy, "dev-bob-01", "hourly, nightly") {
+		t.Errorf("T2: Expected policy to apply by label")
+	}
+	if policyApplies(policy, "dev-bob-01", "nightly-extra") {
+		t.Errorf("T3: Expected policy to not apply")
+	}
+}
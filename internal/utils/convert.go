@@ -1,7 +1,16 @@
 // Package utils is meant to be a collection of functions that could be useful elsewhere
 package utils
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// bytePowers is the power each size suffix raises its base to, k and K are both accepted for kilo
+var bytePowers = map[byte]float64{'k': 1, 'K': 1, 'M': 2, 'G': 3, 'T': 4, 'P': 5, 'E': 6}
 
 // MakeBytesMoreHuman takes in a uint64 value that is meant to be something in bytes, like
 // memory usage, disk usage, etc.  It returns a string converted to and having the appropriate
@@ -24,3 +33,32 @@ func MakeBytesMoreHuman(bytes uint64) string {
 func MakeIntBytesMoreHuman(bytes int64) string {
 	return MakeBytesMoreHuman(uint64(bytes))
 }
+
+// ParseByteSize goes the other way, taking a size the way LXD writes them like 512MB or 2GiB and returning bytes.
+// Like LXD, suffixes with an i are powers of 1024, the others powers of 1000, and no suffix at all is bytes
+func ParseByteSize(size string) (uint64, error) {
+	value := strings.TrimSuffix(strings.TrimSpace(size), "B")
+
+	base := 1000.0
+	if strings.HasSuffix(value, "i") {
+		base = 1024
+		value = strings.TrimSuffix(value, "i")
+	}
+
+	power := 0.0
+	if value != "" {
+		if p, ok := bytePowers[value[len(value)-1]]; ok {
+			power = p
+			value = strings.TrimSpace(value[:len(value)-1])
+		} else if base == 1024 {
+			return 0, errors.New("invalid size: " + size)
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, errors.New("invalid size: " + size)
+	}
+
+	return uint64(number * math.Pow(base, power)), nil
+}